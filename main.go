@@ -2,28 +2,47 @@ package main
 
 import (
 	"LiveStatus/src/boot"
+	"flag"
 	"log"
+	"log/slog"
+	"os"
 )
 
 func main() {
-	config, err := boot.LoadConfig()
+	configPath := flag.String("config", boot.GetConfigPath(), "path of the config file")
+	flag.Parse()
+
+	if flag.Arg(0) == "validate" {
+		validateFlags := flag.NewFlagSet("validate", flag.ExitOnError)
+		validateFlags.StringVar(configPath, "config", *configPath, "path of the config file")
+		online := validateFlags.Bool("online", false, "also check the streamers on Twitch and the guilds, channels and permissions on Discord")
+		_ = validateFlags.Parse(flag.Args()[1:])
+		os.Exit(boot.Validate(*configPath, *online))
+	}
+
+	if flag.Arg(0) == "healthcheck" {
+		healthcheckFlags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+		healthcheckFlags.StringVar(configPath, "config", *configPath, "path of the config file")
+		url := healthcheckFlags.String("url", "", "endpoint to probe, defaults to /healthz on the webhook port of the config")
+		_ = healthcheckFlags.Parse(flag.Args()[1:])
+		os.Exit(boot.Healthcheck(*configPath, *url))
+	}
+
+	config, err := boot.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("loadConfig: %v", err)
 	}
 
-	handler, logFile, database, err := boot.Init(config)
-	defer func() {
-		if database != nil {
-			_ = database.Close()
-		}
-		if logFile != nil {
-			_ = logFile.Close()
-		}
-	}()
+	app, err := boot.Init(*configPath, config)
 	if err != nil {
-		log.Printf("ERROR inits: %v", err)
-		return
+		slog.Error("Init failed", "error", err)
+	} else if err = boot.StartHttpHandler(app, config); err != nil {
+		slog.Error("Server failed", "error", err)
+	}
+	if closeErr := app.Close(); closeErr != nil {
+		slog.Error("Close failed", "error", closeErr) // Only on stdout, the log file is closed last
+	}
+	if err != nil {
+		os.Exit(1)
 	}
-
-	boot.StartHttpHandler(handler, config.Twitch.WebhookPort)
 }
@@ -0,0 +1,172 @@
+package boot
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"LiveStatus/src/usecase"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+var (
+	yamlLineRegex         = regexp.MustCompile(`^line (\d+): (.*)$`)
+	yamlUnknownFieldRegex = regexp.MustCompile(`^field (\S+) not found in type .*$`)
+)
+
+// configSources tells where the values of the config come from, to report the problems with their file line or environment variable
+type configSources struct {
+	fileName string
+	lines    domain.ConfigLines
+	envs     map[string]string // Key is the config path, value is the environment variable overriding it
+}
+
+func (c *configSources) resolve(problems domain.ConfigProblems) {
+	for index, problem := range problems {
+		if env, ok := c.envs[problem.Path]; ok && problem.Source == "" {
+			problems[index].Source = env
+		}
+	}
+	c.lines.Resolve(c.fileName, problems)
+	slices.SortStableFunc(problems, func(a, b domain.ConfigProblem) int { return a.Line - b.Line })
+}
+
+// GetConfigPath returns the config file given by the ConfigPathEnv environment variable or the default one
+func GetConfigPath() string {
+	if configPath, ok := os.LookupEnv(domain.ConfigPathEnv); ok && configPath != "" {
+		return configPath
+	}
+	return domain.DefaultConfigFileName
+}
+
+// Validate prints every problem of the config and returns the exit code of the validate subcommand,
+// online also checks the config against Twitch and Discord
+func Validate(configPath string, online bool) int {
+	config, sources, err := loadConfig(configPath)
+	if err != nil {
+		printConfigError(err)
+		return 1
+	}
+
+	if online {
+		var problems domain.ConfigProblems
+		twClient := internal.NewTwitchClient(config.Twitch, nil, usecase.NewTwitchSubscriber)
+		dcSession, err := discordgo.New("Bot " + config.Discord.Token)
+		if err != nil {
+			printConfigError(err)
+			return 1
+		}
+
+		checker := usecase.NewConfigChecker(twClient, dcSession, nil)
+		problems = append(problems, checker.CheckTwitch(*config)...)
+		problems = append(problems, checker.CheckDiscord(*config)...)
+		if len(problems) > 0 {
+			sources.resolve(problems)
+			printConfigError(problems)
+			return 1
+		}
+	}
+
+	fmt.Printf("%s is valid\n", configPath)
+	return 0
+}
+
+func printConfigError(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, err)
+}
+
+// LoadConfig reads the config file, applies the environment overrides and rejects the config with every problem found,
+// see domain.Config Validate
+func LoadConfig(configPath string) (*domain.Config, error) {
+	config, _, err := loadConfig(configPath)
+	return config, err
+}
+
+func loadConfig(configPath string) (*domain.Config, *configSources, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var root yaml.Node
+	if err = yaml.Unmarshal(content, &root); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	sources := &configSources{fileName: configPath, lines: make(domain.ConfigLines)}
+	fillConfigLines(sources.lines, "", &root)
+
+	var problems domain.ConfigProblems
+
+	// Unknown fields are rejected to catch typos like roleMentionID
+	config := domain.NewDefaultConfig()
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, sources, fmt.Errorf("%s: %w", configPath, err)
+		}
+		for _, message := range typeErr.Errors {
+			problem := domain.ConfigProblem{Path: "yaml", Message: message}
+			if match := yamlLineRegex.FindStringSubmatch(message); match != nil {
+				problem.Line, _ = strconv.Atoi(match[1])
+				problem.Message = yamlUnknownFieldRegex.ReplaceAllString(match[2], "unknown field $1")
+			}
+			problems = append(problems, problem)
+		}
+	}
+
+	var envProblems domain.ConfigProblems
+	sources.envs, envProblems = applyEnvOverrides(&config)
+	problems = append(problems, envProblems...)
+
+	i18n, err := internal.NewI18n()
+	if err != nil {
+		return nil, sources, fmt.Errorf("failed to load %s to validate the config: %w", domain.I18nDirectory, err)
+	}
+	i18nMessages := make(map[string]domain.I18nMessages)
+	for _, lang := range i18n.GetLangs() {
+		i18nMessages[lang] = i18n.GetMessages(lang)
+	}
+
+	problems = append(problems, config.Validate(i18nMessages)...)
+	if len(problems) > 0 {
+		sources.resolve(problems)
+		return nil, sources, problems
+	}
+
+	return &config, sources, nil
+}
+
+// fillConfigLines maps every path of the yaml document to its line, using the paths of domain.ConfigProblem
+func fillConfigLines(lines domain.ConfigLines, path string, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			fillConfigLines(lines, path, child)
+		}
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			key, value := node.Content[index], node.Content[index+1]
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+			lines[childPath] = key.Line
+			fillConfigLines(lines, childPath, value)
+		}
+	case yaml.SequenceNode:
+		for index, child := range node.Content {
+			childPath := fmt.Sprintf("%s[%d]", path, index)
+			lines[childPath] = child.Line
+			fillConfigLines(lines, childPath, child)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package boot
+
+import (
+	"LiveStatus/src/domain"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// applyEnvOverrides overrides every scalar of the config sections with its LIVESTATUS_<SECTION>_<FIELD> environment variable,
+// or with the content of the file given by LIVESTATUS_<SECTION>_<FIELD>_FILE (Docker and Kubernetes secrets).
+// It returns the environment variable of every overridden path
+func applyEnvOverrides(config *domain.Config) (map[string]string, domain.ConfigProblems) {
+	envs := make(map[string]string)
+	var problems domain.ConfigProblems
+
+	sections := reflect.ValueOf(config).Elem()
+	for sectionIndex := 0; sectionIndex < sections.NumField(); sectionIndex++ {
+		sectionName := getYamlName(sections.Type().Field(sectionIndex))
+		section := sections.Field(sectionIndex)
+		if sectionName == "" || section.Kind() != reflect.Struct {
+			continue
+		}
+
+		for fieldIndex := 0; fieldIndex < section.NumField(); fieldIndex++ {
+			fieldName := getYamlName(section.Type().Field(fieldIndex))
+			field := section.Field(fieldIndex)
+			if fieldName == "" || !isEnvScalar(field.Kind()) {
+				continue
+			}
+
+			path := sectionName + "." + fieldName
+			env := domain.ConfigEnvPrefix + getEnvName(sectionName) + "_" + getEnvName(fieldName)
+			value, source, err := lookupEnv(env)
+			if err != nil {
+				problems = append(problems, domain.ConfigProblem{Source: source, Path: path, Message: err.Error()})
+				continue
+			} else if source == "" {
+				continue
+			}
+
+			envs[path] = source
+			if err = setEnvScalar(field, value); err != nil {
+				problems = append(problems, domain.ConfigProblem{Source: source, Path: path, Message: err.Error()})
+			}
+		}
+	}
+
+	return envs, problems
+}
+
+// lookupEnv returns the value of the environment variable or of its _FILE variant, source is the variable used, empty when none is set
+func lookupEnv(env string) (string, string, error) {
+	value, ok := os.LookupEnv(env)
+	fileEnv := env + domain.ConfigEnvFileSuffix
+	filePath, fileOk := os.LookupEnv(fileEnv)
+	if ok && fileOk {
+		return "", env, fmt.Errorf("%s and %s can't be both set", env, fileEnv)
+	} else if ok {
+		return value, env, nil
+	} else if !fileOk {
+		return "", "", nil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fileEnv, fmt.Errorf("failed to read the secret file: %w", err)
+	}
+	// Secret files are usually written with a trailing new line
+	return strings.TrimRight(string(content), "\r\n"), fileEnv, nil
+}
+
+func isEnvScalar(kind reflect.Kind) bool {
+	return kind == reflect.String || kind == reflect.Int || kind == reflect.Int64 || kind == reflect.Bool
+}
+
+func setEnvScalar(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.Int64: // time.Duration
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration like 24h, got %q", value)
+		}
+		field.SetInt(int64(duration))
+	case reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be an integer, got %q", value)
+		}
+		field.SetInt(int64(number))
+	case reflect.Bool:
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean, got %q", value)
+		}
+		field.SetBool(boolean)
+	default:
+		field.SetString(value)
+	}
+	return nil
+}
+
+func getYamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// getEnvName converts a yaml name to an environment variable name, e.g. webhookSecret to WEBHOOK_SECRET
+func getEnvName(yamlName string) string {
+	var envName strings.Builder
+	for index, char := range yamlName {
+		if unicode.IsUpper(char) && index > 0 {
+			envName.WriteRune('_')
+		}
+		envName.WriteRune(unicode.ToUpper(char))
+	}
+	return envName.String()
+}
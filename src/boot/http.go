@@ -1,20 +1,152 @@
 package boot
 
 import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
 	"LiveStatus/src/usecase"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 )
 
-func StartHttpHandler(handler usecase.TwitchHandler, port int) {
-	done := make(chan bool)
-	go func() {
-		err := http.ListenAndServe(":"+strconv.Itoa(port), handler.GetHandler())
+// HttpHandlers are the handlers served by StartHttpHandler
+type HttpHandlers struct {
+	Twitch    usecase.TwitchHandler
+	Metrics   http.Handler
+	Health    usecase.Health
+	Api       http.Handler
+	Dashboard http.Handler
+}
+
+// StartHttpHandler serves the webhook, the metrics, the admin API and the dashboard until SIGINT or SIGTERM, then shuts the app down gracefully
+func StartHttpHandler(app *App, config *domain.Config) error {
+	handlers := app.Handlers
+	mux := http.NewServeMux()
+	mux.Handle("/", handlers.Twitch.GetHandler())
+	mux.HandleFunc(domain.HealthPath, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(domain.ReadinessOk))
+	})
+	mux.HandleFunc(domain.ReadyPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeReadiness(w, domain.ReadinessReport{Ready: handlers.Health.CheckReadiness().Ready}) // Checks are in the admin API
+	})
+
+	servers := []*http.Server{{Addr: ":" + strconv.Itoa(config.Twitch.WebhookPort), Handler: mux}}
+	addressMuxes := make(map[string]*http.ServeMux) // Metrics, admin API and dashboard can share their address
+	handle := func(address string, pattern string, handler http.Handler) {
+		if address == "" {
+			mux.Handle(pattern, handler)
+			return
+		}
+		if _, ok := addressMuxes[address]; !ok {
+			addressMuxes[address] = http.NewServeMux()
+			servers = append(servers, &http.Server{Addr: address, Handler: addressMuxes[address]})
+		}
+		addressMuxes[address].Handle(pattern, handler)
+	}
+	if config.Metrics.Enabled {
+		handle(config.Metrics.Address, domain.MetricsPath, handlers.Metrics)
+	}
+	if config.Api.Enabled {
+		handle(config.Api.Address, domain.ApiBasePath+"/", handlers.Api)
+	}
+	if config.Dashboard.Enabled {
+		handle(config.Dashboard.Address, domain.DashboardPath+"/", handlers.Dashboard)
+	}
+
+	listenErrs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				listenErrs <- fmt.Errorf("listen on %s: %w", server.Addr, err)
+			}
+		}()
+		internal.HttpLog.Info("Server started", "address", server.Addr)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var listenErr error
+	select {
+	case sig := <-signals:
+		internal.HttpLog.Info("Signal received, shutting down", "signal", sig.String())
+	case listenErr = <-listenErrs:
+		internal.HttpLog.Error("Failed to listen, shutting down", "error", listenErr)
+	}
+
+	if err := app.shutdown(servers...); err != nil {
+		internal.HttpLog.Error("Graceful shutdown incomplete", "error", err)
+	} else {
+		internal.HttpLog.Info("Graceful shutdown completed")
+	}
+	return listenErr
+}
+
+func writeReadiness(w http.ResponseWriter, report domain.ReadinessReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Healthcheck probes the liveness endpoint of the running instance, url defaults to the webhook port of the config.
+// It returns the exit code, 0 when alive
+func Healthcheck(configPath string, url string) int {
+	if url == "" {
+		port, err := readWebhookPort(configPath)
 		if err != nil {
-			log.Fatalf("failed to listen: %v\n", err)
+			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-	}()
-	log.Printf("Server started at port %v", port)
-	<-done
+		url = "http://127.0.0.1:" + strconv.Itoa(port) + domain.HealthPath
+	}
+
+	client := &http.Client{Timeout: domain.HealthcheckTimeout}
+	res, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "%s returned %s\n", url, res.Status)
+		return 1
+	}
+	return 0
+}
+
+// readWebhookPort reads twitch.webhookPort and its environment override without validating the config, the running
+// instance is probed while config.yaml can be edited
+func readWebhookPort(configPath string) (int, error) {
+	env := domain.ConfigEnvPrefix + getEnvName("twitch") + "_" + getEnvName("webhookPort")
+	if value, source, err := lookupEnv(env); err != nil {
+		return 0, err
+	} else if source != "" {
+		return strconv.Atoi(value)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return 0, err
+	}
+	var partialConfig struct {
+		Twitch struct {
+			WebhookPort int `yaml:"webhookPort"`
+		} `yaml:"twitch"`
+	}
+	if err = yaml.Unmarshal(content, &partialConfig); err != nil {
+		return 0, fmt.Errorf("%s: %w", configPath, err)
+	} else if partialConfig.Twitch.WebhookPort == 0 {
+		return 0, fmt.Errorf("%s: twitch.webhookPort is not set", configPath)
+	}
+	return partialConfig.Twitch.WebhookPort, nil
 }
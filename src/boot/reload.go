@@ -0,0 +1,150 @@
+package boot
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"LiveStatus/src/usecase"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type configReloader struct {
+	configPath     string
+	configStore    internal.ConfigStore
+	configUpdater  usecase.ConfigUpdater
+	i18n           internal.I18n
+	dcCommand      usecase.DiscordCommand
+	dcAdminCommand usecase.DiscordAdminCommand
+}
+
+// initConfigReload reloads the config file and the i18n directory on SIGHUP or when a file changes
+func initConfigReload(reloader *configReloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(domain.ConfigWatchInterval)
+		defer ticker.Stop()
+
+		configSignature, i18nSignature := getFilesSignature(reloader.configPath), getFilesSignature(domain.I18nDirectory)
+		for {
+			select {
+			case <-signals:
+				internal.ConfigLog.Info("SIGHUP received, reloading configuration")
+				reloader.reloadConfig()
+				reloader.reloadI18n()
+				configSignature, i18nSignature = getFilesSignature(reloader.configPath), getFilesSignature(domain.I18nDirectory)
+			case <-ticker.C:
+				if signature := getFilesSignature(reloader.configPath); signature != configSignature {
+					configSignature = signature
+					internal.ConfigLog.Info("Config file changed, reloading configuration", "path", reloader.configPath)
+					reloader.reloadConfig()
+				}
+				if signature := getFilesSignature(domain.I18nDirectory); signature != i18nSignature {
+					i18nSignature = signature
+					internal.ConfigLog.Info("Messages changed, reloading them", "path", domain.I18nDirectory)
+					reloader.reloadI18n()
+				}
+			}
+		}
+	}()
+}
+
+func (r *configReloader) reloadConfig() {
+	newConfig, err := LoadConfig(r.configPath)
+	if err != nil {
+		internal.ConfigLog.Error("reloadConfig LoadConfig failed, keeping the running configuration", "error", err)
+		return
+	}
+
+	keepRestartRequiredFields(r.configStore.Get(), newConfig)
+	if err = r.configUpdater.Apply(newConfig); err != nil {
+		internal.ConfigLog.Error("reloadConfig Apply failed", "error", err)
+		return
+	}
+	internal.SetLogLevels(newConfig.Log)
+	internal.ConfigLog.Info("Configuration reloaded")
+}
+
+func (r *configReloader) reloadI18n() {
+	changedLangs, err := r.i18n.Reload()
+	if err != nil {
+		internal.ConfigLog.Error("reloadI18n Reload failed, keeping the running messages", "error", err)
+		return
+	}
+	if len(changedLangs) == 0 {
+		return
+	}
+
+	// Commands are localized with the guild lang, only the guilds using a changed lang are registered again
+	config := r.configStore.Get()
+	var guildIds []string
+	for guildId := range config.Discord.Servers {
+		if slices.Contains(changedLangs, config.Discord.GetGuildLang(guildId)) {
+			guildIds = append(guildIds, guildId)
+		}
+	}
+	if err = r.dcCommand.RegisterGuildCommands(guildIds); err != nil {
+		internal.ConfigLog.Error("reloadI18n RegisterGuildCommands failed", "error", err)
+	}
+	// The admin command is global, its descriptions and lang choices can change with any lang
+	if err = r.dcAdminCommand.RegisterCommands(); err != nil {
+		internal.ConfigLog.Error("reloadI18n RegisterCommands failed", "error", err)
+	}
+	internal.ConfigLog.Info("Messages reloaded", "langs", changedLangs)
+}
+
+// keepRestartRequiredFields restores the fields used to open connections at startup, they can't change without restarting
+func keepRestartRequiredFields(running *domain.Config, newConfig *domain.Config) {
+	var ignored []string
+	keep := func(name string, runningValue any, newValue any, restore func()) {
+		if runningValue != newValue {
+			ignored = append(ignored, name)
+			restore()
+		}
+	}
+
+	keep("twitch.clientId", running.Twitch.ClientId, newConfig.Twitch.ClientId, func() { newConfig.Twitch.ClientId = running.Twitch.ClientId })
+	keep("twitch.clientSecret", running.Twitch.ClientSecret, newConfig.Twitch.ClientSecret, func() { newConfig.Twitch.ClientSecret = running.Twitch.ClientSecret })
+	keep("twitch.webhookUrl", running.Twitch.WebhookUrl, newConfig.Twitch.WebhookUrl, func() { newConfig.Twitch.WebhookUrl = running.Twitch.WebhookUrl })
+	keep("twitch.webhookSecret", running.Twitch.WebhookSecret, newConfig.Twitch.WebhookSecret, func() { newConfig.Twitch.WebhookSecret = running.Twitch.WebhookSecret })
+	keep("twitch.webhookPort", running.Twitch.WebhookPort, newConfig.Twitch.WebhookPort, func() { newConfig.Twitch.WebhookPort = running.Twitch.WebhookPort })
+	keep("twitch.helixUrl", running.Twitch.HelixUrl, newConfig.Twitch.HelixUrl, func() { newConfig.Twitch.HelixUrl = running.Twitch.HelixUrl })
+	keep("twitch.authUrl", running.Twitch.AuthUrl, newConfig.Twitch.AuthUrl, func() { newConfig.Twitch.AuthUrl = running.Twitch.AuthUrl })
+	keep("discord.token", running.Discord.Token, newConfig.Discord.Token, func() { newConfig.Discord.Token = running.Discord.Token })
+	keep("storage.database", running.Storage.Database, newConfig.Storage.Database, func() { newConfig.Storage.Database = running.Storage.Database })
+	keep("metrics.enabled", running.Metrics.Enabled, newConfig.Metrics.Enabled, func() { newConfig.Metrics.Enabled = running.Metrics.Enabled })
+	keep("metrics.address", running.Metrics.Address, newConfig.Metrics.Address, func() { newConfig.Metrics.Address = running.Metrics.Address })
+	keep("api.enabled", running.Api.Enabled, newConfig.Api.Enabled, func() { newConfig.Api.Enabled = running.Api.Enabled })
+	keep("api.address", running.Api.Address, newConfig.Api.Address, func() { newConfig.Api.Address = running.Api.Address })
+	keep("dashboard.enabled", running.Dashboard.Enabled, newConfig.Dashboard.Enabled, func() { newConfig.Dashboard.Enabled = running.Dashboard.Enabled })
+	keep("dashboard.address", running.Dashboard.Address, newConfig.Dashboard.Address, func() { newConfig.Dashboard.Address = running.Dashboard.Address })
+	keep("log.format", running.Log.Format, newConfig.Log.Format, func() { newConfig.Log.Format = running.Log.Format })
+	keep("log.maxSize", running.Log.MaxSize, newConfig.Log.MaxSize, func() { newConfig.Log.MaxSize = running.Log.MaxSize })
+	keep("log.maxAge", running.Log.MaxAge, newConfig.Log.MaxAge, func() { newConfig.Log.MaxAge = running.Log.MaxAge })
+	keep("log.maxBackups", running.Log.MaxBackups, newConfig.Log.MaxBackups, func() { newConfig.Log.MaxBackups = running.Log.MaxBackups })
+	keep("storage.log", running.Storage.Log, newConfig.Storage.Log, func() { newConfig.Storage.Log = running.Storage.Log })
+
+	if len(ignored) > 0 {
+		internal.ConfigLog.Warn("reloadConfig restart required to apply some fields", "fields", ignored)
+	}
+}
+
+// getFilesSignature returns the names, sizes and modification dates of a file or the files of a directory
+func getFilesSignature(path string) string {
+	var signature strings.Builder
+	_ = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		signature.WriteString(fmt.Sprintf("%s:%d:%d;", filePath, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	return signature.String()
+}
@@ -0,0 +1,92 @@
+package boot
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"LiveStatus/src/usecase"
+	"context"
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron/v2"
+	"io"
+	"net/http"
+)
+
+// App holds the services started by Init, the fields are nil until their service is started
+type App struct {
+	Handlers   *HttpHandlers
+	scheduler  gocron.Scheduler
+	dcSession  *discordgo.Session
+	outbox     usecase.NotificationOutbox
+	board      usecase.DiscordBoard
+	decoration usecase.DiscordDecoration
+	database   internal.Database
+	logFile    io.Closer
+}
+
+// shutdown stops accepting webhooks, stops the cron jobs, drains the in-flight live state updates, the board and
+// decoration updates then the outbox deliveries within domain.ShutdownTimeout, the queued outbox jobs are delivered
+// after the restart
+func (a *App) shutdown(servers ...*http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), domain.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.scheduler != nil {
+		if err := a.scheduler.Shutdown(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.Handlers != nil {
+		if err := a.Handlers.Twitch.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.board != nil {
+		if err := a.board.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.decoration != nil {
+		if err := a.decoration.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.outbox != nil {
+		if err := a.outbox.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the board and decoration updates and the outbox, closes the Discord session, the database then the log file, it can be called after a failed Init
+func (a *App) Close() error {
+	var errs []error
+	ctx, cancel := context.WithTimeout(context.Background(), domain.ShutdownTimeout)
+	defer cancel()
+	if a.board != nil { // Already stopped by shutdown unless Init failed
+		errs = append(errs, a.board.Shutdown(ctx))
+	}
+	if a.decoration != nil {
+		errs = append(errs, a.decoration.Shutdown(ctx))
+	}
+	if a.outbox != nil {
+		errs = append(errs, a.outbox.Shutdown(ctx))
+	}
+	if a.dcSession != nil {
+		errs = append(errs, a.dcSession.Close())
+	}
+	if a.database != nil {
+		errs = append(errs, a.database.Close())
+	}
+	if a.logFile != nil {
+		errs = append(errs, a.logFile.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -5,138 +5,187 @@ import (
 	"LiveStatus/src/internal"
 	"LiveStatus/src/usecase"
 	"github.com/avast/retry-go/v4"
-	"io"
-	"log"
-	"os"
-	"path/filepath"
+	"net/http"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/go-co-op/gocron/v2"
-	"gopkg.in/yaml.v3"
 )
 
-func LoadConfig() (*domain.Config, error) {
-	file, err := os.Open(domain.ConfigFileName)
+// Init starts the services, the returned App must be closed even when it fails
+func Init(configPath string, config *domain.Config) (*App, error) {
+	app := &App{}
+	logFile, err := internal.InitLogger(config.Log, config.Storage.Log)
 	if err != nil {
-		return nil, err
-	}
-
-	all, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-
-	var config domain.Config
-	if err = yaml.Unmarshal(all, &config); err != nil {
-		return nil, err
-	}
-	return &config, nil
-}
-
-func Init(config *domain.Config) (usecase.TwitchHandler, *os.File, internal.Database, error) {
-	logFile, err := initLog()
-	if err != nil {
-		return nil, nil, nil, err
+		return app, err
 	}
+	app.logFile = logFile
 
-	twClient := internal.NewTwitchClient(
-		config.Twitch.ClientId,
-		config.Twitch.ClientSecret,
-		config.Twitch.WebhookUrl,
-		config.Twitch.WebhookSecret,
-		usecase.NewTwitchSubscriber,
-	)
+	metrics := internal.NewMetrics()
+	twClient := internal.NewTwitchClient(config.Twitch, metrics.NewHelixHttpClient(), usecase.NewTwitchSubscriber)
 
-	database := internal.NewDatabase(domain.DatabaseFileName)
+	database := internal.NewDatabase(config.Storage.Database)
 	if err := database.Open(); err != nil {
-		return nil, logFile, nil, err
+		return app, err
 	}
+	app.database = database
 
 	i18n, err := internal.NewI18n()
 	if err != nil {
-		return nil, logFile, database, err
+		return app, err
 	}
 
 	if err := twClient.Init(); err != nil {
-		return nil, logFile, database, err
+		return app, err
 	}
 
+	// Notifiers added with the admin command are stored in database and merged with config.yaml
+	storedServers, err := database.GetAllGuildNotifiers()
+	if err != nil {
+		return app, err
+	}
+	effectiveConfig := config.MergeNotifiers(storedServers)
+
 	subscriber := twClient.GetSubscriber()
-	if err = initTwitchSubscriber(*config, subscriber); err != nil {
-		return nil, logFile, database, err
+	if err = initTwitchSubscriber(*effectiveConfig, subscriber, metrics); err != nil {
+		return app, err
 	}
 
-	err = resolveTwitchNameFromIds(config, twClient)
+	err = resolveTwitchNameFromIds(effectiveConfig, twClient)
 	if err != nil {
-		return nil, logFile, database, err
+		return app, err
 	}
 
-	mapTwitchIdsToState := make(map[string]*domain.LiveState)
-	dcEvent, triggerFunction, err := initDiscord(config, mapTwitchIdsToState, database, i18n)
+	configStore := internal.NewConfigStore(effectiveConfig)
+	mapTwitchIdsToState := domain.NewLiveStates()
+	outbox := usecase.NewNotificationOutbox(database, metrics)
+	dcSession, dcMessage, dcEvent, dcCommand, triggerFunction, err := initDiscord(app, configStore, mapTwitchIdsToState, database, outbox, i18n, metrics)
 	if err != nil {
-		return nil, logFile, database, err
+		return app, err
 	}
+	app.outbox = outbox
 
-	if err = initLiveState(mapTwitchIdsToState, config, triggerFunction, twClient); err != nil {
-		return nil, logFile, database, err
+	imageService := internal.NewImageService(twClient, nil)
+	newLiveState := func(twitchId string, twitchName string) *domain.LiveState {
+		return &domain.LiveState{
+			TriggerFunction: triggerFunction,
+			ImageResolver:   imageService,
+			TwitchId:        twitchId,
+			TwitchName:      twitchName,
+		}
+	}
+	if err = initLiveState(mapTwitchIdsToState, effectiveConfig, newLiveState, twClient); err != nil {
+		return app, err
+	}
+	// After the stored events are updated by the live states
+	if err = dcEvent.CleanOrphanEvents(mapTwitchIdsToState); err != nil {
+		internal.DiscordLog.Warn("Failed to clean the orphan events", "error", err)
 	}
 
-	cron := usecase.NewCron(dcEvent, mapTwitchIdsToState, twClient)
-
-	err = initCron(cron)
-	if err != nil {
-		return nil, logFile, database, err
+	configUpdater := usecase.NewConfigUpdater(config, configStore, database, twClient, mapTwitchIdsToState, dcCommand, newLiveState, metrics)
+	diagnostics := usecase.NewDiagnostics(configStore, usecase.NewConfigChecker(twClient, dcSession, nil))
+	dcAdminCommand := usecase.NewDiscordAdminCommand(configStore, configUpdater, diagnostics, twClient, dcSession, i18n)
+	if err = dcAdminCommand.InitCommands(); err != nil {
+		return app, err
 	}
 
-	handler := usecase.NewTwitchHandler(mapTwitchIdsToState, twClient, config.Twitch.WebhookSecret)
-	return handler, logFile, database, nil
-}
+	initConfigReload(&configReloader{
+		configPath:     configPath,
+		configStore:    configStore,
+		configUpdater:  configUpdater,
+		i18n:           i18n,
+		dcCommand:      dcCommand,
+		dcAdminCommand: dcAdminCommand,
+	})
 
-func initLog() (*os.File, error) {
-	err := os.MkdirAll(filepath.Join(".", filepath.Dir(domain.LogFileName)), os.ModePerm)
-	if err != nil {
-		return nil, err
-	}
+	cron := usecase.NewCron(dcEvent, dcMessage, mapTwitchIdsToState, twClient)
 
-	logFile, err := os.OpenFile(domain.LogFileName, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0666)
+	health := usecase.NewHealth(configStore, dcSession, twClient, database)
+	app.scheduler, err = initCron(cron, diagnostics, health)
 	if err != nil {
-		return nil, err
+		return app, err
 	}
 
-	mw := io.MultiWriter(os.Stdout, logFile)
-	log.SetOutput(mw)
-	return logFile, nil
+	metrics.AddGaugeFunc("livestatus_live_streamers", "Streamers currently live", func() float64 {
+		var count float64
+		for _, state := range mapTwitchIdsToState.All() {
+			if state.IsOnline() {
+				count++
+			}
+		}
+		return count
+	})
+	metrics.AddGaugeFunc("livestatus_outbox_pending_jobs", "Outbox jobs waiting to be delivered", func() float64 {
+		jobs, _ := outbox.GetJobs()
+		return float64(len(jobs))
+	})
+	metrics.AddGaugeFunc("livestatus_outbox_dead_jobs", "Outbox jobs given up, see the admin API", func() float64 {
+		jobs, _ := outbox.GetDeadJobs()
+		return float64(len(jobs))
+	})
+
+	handler := usecase.NewTwitchHandler(mapTwitchIdsToState, twClient, config.Twitch.WebhookSecret, dcMessage.HandleRaid, metrics)
+	adminApi := usecase.NewAdminApi(configStore, mapTwitchIdsToState, database, twClient, cron, outbox, dcMessage, dcCommand, dcAdminCommand, health)
+	oauth := internal.NewDiscordOAuth(&http.Client{Timeout: domain.DashboardHttpTimeout})
+	dashboard := usecase.NewDashboard(configStore, configUpdater, mapTwitchIdsToState, database, dcSession, dcMessage, i18n, oauth)
+	app.Handlers = &HttpHandlers{Twitch: handler, Metrics: metrics.GetHandler(), Health: health, Api: adminApi.GetHandler(), Dashboard: dashboard.GetHandler()}
+	return app, nil
 }
 
-func initCron(dcCron usecase.Cron) error {
-	scheduler, err := gocron.NewScheduler()
+func initCron(dcCron usecase.Cron, diagnostics usecase.Diagnostics, health usecase.Health) (gocron.Scheduler, error) {
+	scheduler, err := gocron.NewScheduler(gocron.WithStopTimeout(domain.ShutdownCronTimeout))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	_, err = scheduler.NewJob(gocron.CronJob("* * * * *", false), gocron.NewTask(func() { // every minute
 		if eventErr := retry.Do(dcCron.RefreshDiscordEvent, retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay)); eventErr != nil {
-			log.Printf("ERROR RefreshDiscordEvent: %v\n", eventErr)
+			internal.CronLog.Error("RefreshDiscordEvent failed", "error", eventErr)
+		} else {
+			health.CronSucceeded(domain.CronRefreshDiscordEvent)
 		}
 	}))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	health.WatchCron(domain.CronRefreshDiscordEvent, domain.CronRefreshDiscordEventInterval)
 
 	_, err = scheduler.NewJob(gocron.CronJob("*/5 * * * *", false), gocron.NewTask(func() { // every 5 minutes
 		if eventErr := retry.Do(dcCron.RefreshTwitchStreams, retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay)); eventErr != nil {
-			log.Printf("ERROR RefreshTwitchStreams: %v\n", eventErr)
+			internal.CronLog.Error("RefreshTwitchStreams failed", "error", eventErr)
+		} else {
+			health.CronSucceeded(domain.CronRefreshTwitchStreams)
 		}
 	}))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	health.WatchCron(domain.CronRefreshTwitchStreams, domain.CronRefreshTwitchStreamsInterval)
+
+	_, err = scheduler.NewJob(gocron.CronJob("* * * * *", false), gocron.NewTask(func() { // every minute
+		if threadErr := retry.Do(dcCron.ArchiveDiscordThreads, retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay)); threadErr != nil {
+			internal.CronLog.Error("ArchiveDiscordThreads failed", "error", threadErr)
+		} else {
+			health.CronSucceeded(domain.CronArchiveDiscordThreads)
+		}
+	}))
+	if err != nil {
+		return nil, err
+	}
+	health.WatchCron(domain.CronArchiveDiscordThreads, domain.CronArchiveDiscordThreadsInterval)
+
+	// First run once the webhook server is started, the report is logged
+	_, err = scheduler.NewJob(gocron.DurationJob(domain.DiagnosticsInterval), gocron.NewTask(func() { diagnostics.Run() }),
+		gocron.WithStartAt(gocron.WithStartDateTime(time.Now().Add(domain.DiagnosticsStartupDelay))))
+	if err != nil {
+		return nil, err
 	}
 
 	scheduler.Start()
-	return nil
+	return scheduler, nil
 }
 
-func initTwitchSubscriber(config domain.Config, subscriber domain.TwitchSubscriber) error {
+func initTwitchSubscriber(config domain.Config, subscriber domain.TwitchSubscriber, metrics *internal.Metrics) error {
 	err := subscriber.UnsubscribeAll()
 	if err != nil {
 		return err
@@ -148,7 +197,10 @@ func initTwitchSubscriber(config domain.Config, subscriber domain.TwitchSubscrib
 		return err
 	}
 
-	log.Printf("Subscribed to %d broadcasters with a total cost of %d/%d\n", len(broadcasterUserIds), totalCost, maxTotalCost)
+	if len(broadcasterUserIds) > 0 {
+		metrics.SetSubscriptionCost(totalCost, maxTotalCost)
+	}
+	internal.TwitchLog.Info("Subscribed to broadcasters", "count", len(broadcasterUserIds), "totalCost", totalCost, "maxTotalCost", maxTotalCost)
 	return nil
 }
 
@@ -161,50 +213,74 @@ func resolveTwitchNameFromIds(config *domain.Config, twitchClient internal.Twitc
 	config.Twitch.UserResolver = make(map[string]domain.TwitchUserResolver)
 	for twitchId, twitchUser := range mapIdToUser {
 		config.Twitch.UserResolver[twitchId] = domain.TwitchUserResolver{
-			TwitchId:          twitchId,
-			TwitchName:        twitchUser.Login,
-			TwitchDisplayName: twitchUser.DisplayName,
+			TwitchId:              twitchId,
+			TwitchName:            twitchUser.Login,
+			TwitchDisplayName:     twitchUser.DisplayName,
+			TwitchProfileImageUrl: twitchUser.ProfileImageUrl,
 		}
 	}
 
 	return nil
 }
 
-func initDiscord(config *domain.Config, mapTwitchIdsToState map[string]*domain.LiveState, database internal.Database, i18n internal.I18n) (usecase.DiscordEvent, func(state domain.LiveState) error, error) {
-	dcSession, err := discordgo.New("Bot " + config.Discord.Token)
+// initDiscord opens the Discord session, the services with background updates are set on the app to be stopped on shutdown
+func initDiscord(app *App, configStore internal.ConfigStore, mapTwitchIdsToState *domain.LiveStates, database internal.Database, outbox usecase.NotificationOutbox, i18n internal.I18n, metrics *internal.Metrics) (*discordgo.Session, usecase.DiscordMessage, usecase.DiscordEvent, usecase.DiscordCommand, func(state domain.LiveState) error, error) {
+	dcSession, err := discordgo.New("Bot " + configStore.Get().Discord.Token)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, nil, err
 	}
 
-	dcMessage := usecase.NewDiscordMessage(dcSession, config.Discord, database, i18n)
-	dcEvent := usecase.NewDiscordEvent(dcSession, config.Discord, database, i18n)
-	dcCommand := usecase.NewDiscordCommand(config, mapTwitchIdsToState, dcSession, dcMessage, i18n)
+	metrics.InstrumentDiscordHttpClient(dcSession.Client)
+	internal.LimitDiscordHttpClient(dcSession.Client) // Outside the instrumentation, the wait is not measured
+
+	dispatcher := usecase.NewDiscordDispatcher(dcSession.Ratelimiter)
+	dcMessage := usecase.NewDiscordMessage(dcSession, configStore, database, outbox, dispatcher, i18n, metrics)
+	dcEvent := usecase.NewDiscordEvent(dcSession, configStore, database, dispatcher, i18n, metrics)
+	dcCommand := usecase.NewDiscordCommand(configStore, mapTwitchIdsToState, dcSession, dcMessage, i18n)
+	dcBoard := usecase.NewDiscordBoard(dcSession, configStore, database, mapTwitchIdsToState, i18n, metrics)
+	app.board = dcBoard
+	dcDecoration := usecase.NewDiscordDecoration(dcSession, configStore, mapTwitchIdsToState, i18n)
+	app.decoration = dcDecoration
 
 	dcSession.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
-		log.Printf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator)
+		internal.DiscordLog.Info("Logged in", "username", s.State.User.Username, "discriminator", s.State.User.Discriminator)
+		dcDecoration.HandleReady()
 	})
 
 	err = dcSession.Open()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, nil, err
 	}
+	app.dcSession = dcSession // Closed by App.Close when the rest of the startup fails
 
 	err = dcCommand.InitCommands()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, nil, err
 	}
 
+	// Jobs left by the previous run are delivered first
+	outbox.Start(dcMessage)
+
+	streamHistory := usecase.NewStreamHistory(database)
 	triggerFunction := func(state domain.LiveState) error {
+		if err := streamHistory.HandleLiveState(state); err != nil {
+			internal.TwitchLog.Warn("Failed to record the stream session", "twitchId", state.TwitchId, "error", err) // Not retried, the history is informative
+		}
+		dcBoard.HandleLiveState(state)
+		dcDecoration.HandleLiveState(state)
+		// The announcements are queued first and do not depend on the events, a failing guild must not hold them. Only
+		// the queueing is retried, the events failing here are reconciled by the RefreshDiscordEvent cron
+		messageErr := dcMessage.HandleLiveState(state)
 		if err := dcEvent.HandleLiveState(state); err != nil {
-			return err
+			internal.DiscordLog.Warn("Failed to update the events, left to the next refresh", "twitchId", state.TwitchId, "error", err)
 		}
-		return dcMessage.HandleLiveState(state)
+		return messageErr
 	}
 
-	return dcEvent, triggerFunction, nil
+	return dcSession, dcMessage, dcEvent, dcCommand, triggerFunction, nil
 }
 
-func initLiveState(mapTwitchIdToLiveState map[string]*domain.LiveState, config *domain.Config, triggerFunction func(state domain.LiveState) error, twClient internal.TwitchClient) error {
+func initLiveState(mapTwitchIdToLiveState *domain.LiveStates, config *domain.Config, newLiveState func(twitchId string, twitchName string) *domain.LiveState, twClient internal.TwitchClient) error {
 	var twitchIds []string
 	for twitchId := range config.Twitch.UserResolver {
 		twitchIds = append(twitchIds, twitchId)
@@ -220,11 +296,7 @@ func initLiveState(mapTwitchIdToLiveState map[string]*domain.LiveState, config *
 	}
 
 	for twitchId, userResolver := range config.Twitch.UserResolver {
-		liveState := &domain.LiveState{
-			TriggerFunction: triggerFunction,
-			TwitchId:        twitchId,
-			TwitchName:      userResolver.TwitchName,
-		}
+		liveState := newLiveState(twitchId, userResolver.TwitchName)
 
 		if stream, ok := streamsResponse[twitchId]; ok {
 			if err := liveState.SetLiveState(&stream); err != nil {
@@ -236,7 +308,7 @@ func initLiveState(mapTwitchIdToLiveState map[string]*domain.LiveState, config *
 			}
 		}
 
-		mapTwitchIdToLiveState[twitchId] = liveState
+		mapTwitchIdToLiveState.Set(liveState)
 	}
 
 	return nil
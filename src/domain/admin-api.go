@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ApiBasePath     = "/api/v1"
+	ApiOpenApiPath  = ApiBasePath + "/openapi.yaml"
+	ApiOpenApiFile  = "openapi.yaml" // Relative to the working directory, like I18nDirectory
+	ApiPathTwitchId = "twitchId"
+	ApiPathChannel  = "channelId"
+	ApiPathJobId    = "jobId"
+)
+
+var (
+	ErrStreamerNotFound     = errors.New("streamer not found")
+	ErrAnnouncementNotFound = errors.New("announcement not found")
+	ErrStreamerOffline      = errors.New("streamer offline")
+)
+
+// ApiStreamer is the live state of a streamer with the ids of its Discord messages and events
+type ApiStreamer struct {
+	TwitchId        string            `json:"twitchId"`
+	TwitchName      string            `json:"twitchName"`
+	EventStreamType string            `json:"eventStreamType,omitempty"`
+	Online          bool              `json:"online"`
+	StreamType      string            `json:"streamType,omitempty"`
+	Title           string            `json:"title,omitempty"`
+	GameName        string            `json:"gameName,omitempty"`
+	ViewerCount     int               `json:"viewerCount,omitempty"`
+	StartedAt       *time.Time        `json:"startedAt,omitempty"`
+	Announcements   []ApiAnnouncement `json:"announcements"`
+	Events          []ApiEvent        `json:"events"`
+}
+
+// ApiAnnouncement is a notifier channel of a streamer, MessageId is empty when no message is stored
+type ApiAnnouncement struct {
+	GuildId   string `json:"guildId"`
+	ChannelId string `json:"channelId"`
+	MessageId string `json:"messageId"`
+}
+
+// ApiEvent is a notifier guild of a streamer, EventId is empty when no scheduled event is stored
+type ApiEvent struct {
+	GuildId string `json:"guildId"`
+	EventId string `json:"eventId"`
+}
+
+// ApiOutboxJob is a pending or dead announcement job of the outbox
+type ApiOutboxJob struct {
+	Id            uint64     `json:"id"`
+	Key           string     `json:"key"`
+	Intent        string     `json:"intent"`
+	GuildId       string     `json:"guildId"`
+	TwitchId      string     `json:"twitchId"`
+	ChannelId     string     `json:"channelId"`
+	Online        bool       `json:"online"`
+	Attempts      int        `json:"attempts"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+func NewApiOutboxJob(job OutboxJob) ApiOutboxJob {
+	apiJob := ApiOutboxJob{
+		Id:        job.Id,
+		Key:       job.Key,
+		Intent:    job.Intent,
+		GuildId:   job.GuildId,
+		TwitchId:  job.Notifier.TwitchId,
+		ChannelId: job.Notifier.Message.ChannelId,
+		Online:    job.State.IsOnline(),
+		Attempts:  job.Attempts,
+		CreatedAt: job.CreatedAt,
+		LastError: job.LastError,
+	}
+	if !job.NextAttemptAt.IsZero() {
+		apiJob.NextAttemptAt = &job.NextAttemptAt
+	}
+	return apiJob
+}
+
+type ApiError struct {
+	Error string `json:"error"`
+}
@@ -5,11 +5,32 @@ import "time"
 const (
 	twitchTypeLive = "live"
 
-	GetTwitchAppTokenUrl      = "https://id.twitch.tv/oauth2/token"
-	GetTwitchStreamsUrl       = "https://api.twitch.tv/helix/streams"
-	GetTwitchUsersUrl         = "https://api.twitch.tv/helix/users"
-	TwitchClientIdHeader      = "Client-Id"
-	TwitchAuthorizationHeader = "Authorization"
+	TwitchAuthBaseUrl  = "https://id.twitch.tv/oauth2"
+	TwitchHelixBaseUrl = "https://api.twitch.tv/helix"
+	TwitchTokenPath    = "/token"
+	TwitchStreamsPath  = "/streams"
+	TwitchUsersPath    = "/users"
+	TwitchGamesPath    = "/games"
+	TwitchPreviewUrl   = "https://static-cdn.jtvnw.net/previews-ttv/live_user_%s-{width}x{height}.jpg" // %s is the login
+
+	TwitchClientIdHeader           = "Client-Id"
+	TwitchAuthorizationHeader      = "Authorization"
+	TwitchRateLimitLimitHeader     = "Ratelimit-Limit"
+	TwitchRateLimitRemainingHeader = "Ratelimit-Remaining"
+	TwitchRateLimitResetHeader     = "Ratelimit-Reset"
+	ETagHeader                     = "ETag"
+	IfNoneMatchHeader              = "If-None-Match"
+	LastModifiedHeader             = "Last-Modified"
+	IfModifiedSinceHeader          = "If-Modified-Since"
+
+	TwitchEventSubMessageIdHeader        = "Twitch-Eventsub-Message-Id"
+	TwitchEventSubMessageRetryHeader     = "Twitch-Eventsub-Message-Retry"
+	TwitchEventSubMessageTypeHeader      = "Twitch-Eventsub-Message-Type"
+	TwitchEventSubMessageTimestampHeader = "Twitch-Eventsub-Message-Timestamp"
+	TwitchEventSubMessageSignatureHeader = "Twitch-Eventsub-Message-Signature"
+	TwitchWebhookVerificationType        = "webhook_callback_verification"
+
+	TwitchMaxIdsPerRequest = 100 // Helix rejects more than 100 id/user_id query parameters
 
 	RetryMaxAttempts = 5
 	RetryDelay       = 5 * time.Second
@@ -18,6 +39,8 @@ const (
 type TwitchSubscriber interface {
 	UnsubscribeAll() error
 	SubscribeAll(broadcasterUserIds []string) (int, int, error)
+	Unsubscribe(broadcasterUserIds []string) error
+	GetSubscriptionStatuses() ([]TwitchSubscriptionStatus, error)
 }
 
 type SubscriberFactory func(clientId, appToken, webhookUrl, webhookSecret string) TwitchSubscriber
@@ -41,7 +64,12 @@ type TwitchUserResponse struct {
 }
 
 type TwitchStreamsResponse struct {
-	Data []TwitchStreamResponse `json:"data"`
+	Data       []TwitchStreamResponse `json:"data"`
+	Pagination TwitchPagination       `json:"pagination"`
+}
+
+type TwitchPagination struct {
+	Cursor string `json:"cursor"`
 }
 
 type TwitchStreamResponse struct {
@@ -61,3 +89,14 @@ type TwitchStreamResponse struct {
 	TagIds       []string  `json:"tag_ids"`
 	IsMature     bool      `json:"is_mature"`
 }
+
+type TwitchGamesResponse struct {
+	Data []TwitchGameResponse `json:"data"`
+}
+
+type TwitchGameResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	BoxArtUrl string `json:"box_art_url"`
+	IgdbId    string `json:"igdb_id"`
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+const (
+	BoardDebounceDelay = 10 * time.Second // Changes within the delay are grouped in a single edit
+	BoardMaxEntries    = 25               // Fields of an embed, the streamers with the most viewers are listed
+)
+
+// DiscordBoard is the single message of a guild listing the live streamers of its notifiers
+type DiscordBoard struct {
+	ChannelId string `yaml:"channelId"`
+	Lang      string `yaml:"lang"`
+}
+
+// DiscordBoardMessage is the stored board message of a guild
+type DiscordBoardMessage struct {
+	ChannelId string `json:"channelId"`
+	MessageId string `json:"messageId"`
+}
@@ -0,0 +1,311 @@
+package domain
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WebhookSecretMinLength = 10
+	WebhookSecretMaxLength = 100
+	ApiTokenMinLength      = 16
+)
+
+var (
+	snowflakeRegex    = regexp.MustCompile(`^\d{17,20}$`)
+	twitchIdRegex     = regexp.MustCompile(`^\d+$`)
+	notifierPathRegex = regexp.MustCompile(`^discord\.servers\.([^.\[]+)\[(\d+)]`)
+)
+
+type ConfigProblem struct {
+	Source  string // Config file or environment variable the value comes from, empty when unknown
+	Path    string // e.g. discord.servers.<guildId>[0].message.channelId
+	Line    int    // Line in the config file, 0 when unknown
+	Message string
+}
+
+func (p ConfigProblem) String() string {
+	if p.Source == "" {
+		return fmt.Sprintf("%s: %s", p.Path, p.Message)
+	}
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d %s: %s", p.Source, p.Line, p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", p.Source, p.Path, p.Message)
+}
+
+type ConfigProblems []ConfigProblem
+
+func (p ConfigProblems) Error() string {
+	lines := make([]string, 0, len(p))
+	for _, problem := range p {
+		lines = append(lines, problem.String())
+	}
+	return fmt.Sprintf("%d configuration problem(s):\n%s", len(p), strings.Join(lines, "\n"))
+}
+
+// ConfigLines maps a config path to its line in the yaml file
+type ConfigLines map[string]int
+
+// Resolve sets the file of the problems without source and their line, the line of the closest parent is used when the path
+// is missing from the file
+func (l ConfigLines) Resolve(fileName string, problems ConfigProblems) {
+	for index, problem := range problems {
+		if problem.Source != "" {
+			continue
+		}
+		problems[index].Source = fileName
+		for path := problem.Path; path != "" && problem.Line == 0; path = parentConfigPath(path) {
+			if line, ok := l[path]; ok {
+				problems[index].Line = line
+				break
+			}
+		}
+	}
+}
+
+func parentConfigPath(path string) string {
+	index := strings.LastIndexAny(path, ".[")
+	if index < 0 {
+		return ""
+	}
+	return path[:index]
+}
+
+func NotifierConfigPath(guildId string, index int) string {
+	return fmt.Sprintf("discord.servers.%s[%d]", guildId, index)
+}
+
+// FindNotifierByPath returns the notifier of a path built with NotifierConfigPath, nil if the path is not in a notifier
+func (c Config) FindNotifierByPath(path string) (string, *DiscordNotifier) {
+	match := notifierPathRegex.FindStringSubmatch(path)
+	if match == nil {
+		return "", nil
+	}
+	index, err := strconv.Atoi(match[2])
+	notifiers := c.Discord.Servers[match[1]]
+	if err != nil || index >= len(notifiers) {
+		return match[1], nil
+	}
+	return match[1], &notifiers[index]
+}
+
+// Validate reports every problem of the config, i18nMessages (lang as key) is used to check langs and templates
+func (c Config) Validate(i18nMessages map[string]I18nMessages) ConfigProblems {
+	var problems ConfigProblems
+	add := func(path string, format string, args ...any) {
+		problems = append(problems, ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	required := func(path string, value string) bool {
+		if strings.TrimSpace(value) == "" {
+			add(path, "is required")
+			return false
+		}
+		return true
+	}
+	validUrl := func(path string, value string, schemes ...string) {
+		parsedUrl, err := url.Parse(value)
+		if err != nil || parsedUrl.Host == "" || !slices.Contains(schemes, parsedUrl.Scheme) {
+			add(path, "must be a valid %s URL", strings.Join(schemes, "/"))
+		}
+	}
+
+	required("twitch.clientId", c.Twitch.ClientId)
+	required("twitch.clientSecret", c.Twitch.ClientSecret)
+	if required("twitch.webhookUrl", c.Twitch.WebhookUrl) {
+		validUrl("twitch.webhookUrl", c.Twitch.WebhookUrl, "https") // Twitch only sends notifications over HTTPS
+	}
+	if required("twitch.webhookSecret", c.Twitch.WebhookSecret) {
+		if length := len(c.Twitch.WebhookSecret); length < WebhookSecretMinLength || length > WebhookSecretMaxLength {
+			add("twitch.webhookSecret", "must be between %d and %d characters, got %d", WebhookSecretMinLength, WebhookSecretMaxLength, length)
+		}
+		if strings.IndexFunc(c.Twitch.WebhookSecret, func(r rune) bool { return r < 0x20 || r > 0x7e }) >= 0 {
+			add("twitch.webhookSecret", "must only contain printable ASCII characters")
+		}
+	}
+	if c.Twitch.WebhookPort < 1 || c.Twitch.WebhookPort > 65535 {
+		add("twitch.webhookPort", "must be between 1 and 65535, got %d", c.Twitch.WebhookPort)
+	}
+	if c.Twitch.HelixUrl != "" {
+		validUrl("twitch.helixUrl", c.Twitch.HelixUrl, "http", "https")
+	}
+	if c.Twitch.AuthUrl != "" {
+		validUrl("twitch.authUrl", c.Twitch.AuthUrl, "http", "https")
+	}
+
+	required("discord.token", c.Discord.Token)
+	if c.Discord.EventExtension < MinEventExtension {
+		add("discord.eventExtension", "must be at least %s, got %s", MinEventExtension, c.Discord.EventExtension)
+	}
+	required("storage.database", c.Storage.Database)
+	required("storage.log", c.Storage.Log)
+	if !slices.Contains(LogFormats, c.Log.Format) {
+		add("log.format", "unknown format %q, available: %s", c.Log.Format, strings.Join(LogFormats, ", "))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		add("log.level", "unknown level %q, available: debug, info, warn, error", c.Log.Level)
+	}
+	for component, componentLevel := range c.Log.Levels {
+		if !slices.Contains(LogComponents, component) {
+			add("log.levels."+component, "unknown component, available: %s", strings.Join(LogComponents, ", "))
+		}
+		if err := level.UnmarshalText([]byte(componentLevel)); err != nil {
+			add("log.levels."+component, "unknown level %q, available: debug, info, warn, error", componentLevel)
+		}
+	}
+	if c.Log.MaxSize < 0 || c.Log.MaxAge < 0 || c.Log.MaxBackups < 0 {
+		add("log", "maxSize, maxAge and maxBackups must be positive")
+	}
+	if c.Metrics.Enabled {
+		required("metrics.address", c.Metrics.Address)
+	}
+	if _, _, err := net.SplitHostPort(c.Metrics.Address); c.Metrics.Address != "" && err != nil {
+		add("metrics.address", "must be a listen address like \":9090\", got %q", c.Metrics.Address)
+	}
+	if _, _, err := net.SplitHostPort(c.Api.Address); c.Api.Address != "" && err != nil {
+		add("api.address", "must be a listen address like \":9091\", got %q", c.Api.Address)
+	}
+	if _, _, err := net.SplitHostPort(c.Dashboard.Address); c.Dashboard.Address != "" && err != nil {
+		add("dashboard.address", "must be a listen address like \":9092\", got %q", c.Dashboard.Address)
+	}
+	if c.Dashboard.Enabled {
+		if required("dashboard.publicUrl", c.Dashboard.PublicUrl) {
+			validUrl("dashboard.publicUrl", c.Dashboard.PublicUrl, "http", "https")
+		}
+		required("dashboard.clientId", c.Dashboard.ClientId)
+		required("dashboard.clientSecret", c.Dashboard.ClientSecret)
+	}
+	if c.Api.Enabled && required("api.token", c.Api.Token) && len(c.Api.Token) < ApiTokenMinLength {
+		add("api.token", "must be at least %d characters, got %d", ApiTokenMinLength, len(c.Api.Token))
+	}
+	if c.Discord.Presence.RotateInterval < MinPresenceRotateInterval {
+		add("discord.presence.rotateInterval", "must be at least %s, got %s", MinPresenceRotateInterval, c.Discord.Presence.RotateInterval)
+	}
+	for guildId, counter := range c.Discord.Counters {
+		counterPath := fmt.Sprintf("discord.counters.%s", guildId)
+		if !snowflakeRegex.MatchString(guildId) {
+			add(counterPath, "guild id %q must be a Discord id", guildId)
+		}
+		if required(counterPath+".channelId", counter.ChannelId) && !snowflakeRegex.MatchString(counter.ChannelId) {
+			add(counterPath+".channelId", "must be a Discord id, got %q", counter.ChannelId)
+		}
+		if _, ok := i18nMessages[counter.Lang]; counter.Lang != "" && !ok {
+			add(counterPath+".lang", "unknown lang %q, available: %s", counter.Lang, strings.Join(getSortedKeys(i18nMessages), ", "))
+		}
+	}
+	for guildId, board := range c.Discord.Boards {
+		boardPath := fmt.Sprintf("discord.boards.%s", guildId)
+		if !snowflakeRegex.MatchString(guildId) {
+			add(boardPath, "guild id %q must be a Discord id", guildId)
+		}
+		if required(boardPath+".channelId", board.ChannelId) && !snowflakeRegex.MatchString(board.ChannelId) {
+			add(boardPath+".channelId", "must be a Discord id, got %q", board.ChannelId)
+		}
+		if _, ok := i18nMessages[board.Lang]; board.Lang != "" && !ok {
+			add(boardPath+".lang", "unknown lang %q, available: %s", board.Lang, strings.Join(getSortedKeys(i18nMessages), ", "))
+		}
+	}
+	for guildId, notifiers := range c.Discord.Servers {
+		if !snowflakeRegex.MatchString(guildId) {
+			add(fmt.Sprintf("discord.servers.%s", guildId), "guild id %q must be a Discord id", guildId)
+		}
+
+		for index, notifier := range notifiers {
+			path := NotifierConfigPath(guildId, index)
+			if required(path+".twitchId", notifier.TwitchId) && !twitchIdRegex.MatchString(notifier.TwitchId) {
+				add(path+".twitchId", "must be a numeric Twitch id, got %q", notifier.TwitchId)
+			}
+			if slices.IndexFunc(notifiers[:index], func(other DiscordNotifier) bool { return other.TwitchId == notifier.TwitchId }) >= 0 {
+				add(path+".twitchId", "duplicate streamer %s in guild %s", notifier.TwitchId, guildId)
+			}
+
+			messages, langOk := i18nMessages[notifier.Lang]
+			if notifier.Lang != "" && !langOk {
+				add(path+".lang", "unknown lang %q, available: %s", notifier.Lang, strings.Join(getSortedKeys(i18nMessages), ", "))
+			}
+
+			if notifier.Event.Complete && langOk && messages.Discord.Event.Ended.Title == "" {
+				add(path+".event.complete", "discord.event.ended.title is missing in lang %s", notifier.Lang)
+			}
+			if notifier.Message.Thread.Active && langOk && messages.Discord.Thread.Name == "" {
+				add(path+".message.thread.active", "discord.thread.name is missing in lang %s", notifier.Lang)
+			}
+			if _, _, ok := ParseWebhookUrl(notifier.Message.Webhook.Url); notifier.Message.Webhook.Url != "" && !ok {
+				add(path+".message.webhook.url", "must be a Discord webhook URL like https://discord.com/api/webhooks/<id>/<token>")
+			}
+			if notifier.Message.Webhook.Url != "" && notifier.Message.Crosspost {
+				add(path+".message.crosspost", "not available with message.webhook.url, the bot may not see the channel")
+			}
+			if notifier.Message.Thread.ArchiveAfter < 0 {
+				add(path+".message.thread.archiveAfter", "must be positive, got %s", notifier.Message.Thread.ArchiveAfter)
+			}
+			if notifier.Message.Active || notifier.Message.ChannelId != "" {
+				if required(path+".message.channelId", notifier.Message.ChannelId) && !snowflakeRegex.MatchString(notifier.Message.ChannelId) {
+					add(path+".message.channelId", "must be a Discord id, got %q", notifier.Message.ChannelId)
+				}
+			}
+			if roleMentionId := notifier.Message.RoleMentionId; roleMentionId != "" && !slices.Contains(CustomMentions, roleMentionId) && !snowflakeRegex.MatchString(roleMentionId) {
+				add(path+".message.roleMentionId", "must be a Discord role id, %s, or empty, got %q", strings.Join(CustomMentions, ", "), roleMentionId)
+			}
+
+			for streamType, rule := range notifier.StreamTypes {
+				if !slices.Contains(StreamTypes, streamType) {
+					add(path+".streamTypes."+streamType, "unknown stream type, available: %s", strings.Join(StreamTypes, ", "))
+				}
+				if _, ok := messages.Discord.Embed.Templates[rule.Template]; rule.Template != "" && langOk && !ok {
+					add(path+".streamTypes."+streamType+".template", "unknown template %q in lang %s", rule.Template, notifier.Lang)
+				}
+			}
+
+			for ruleIndex, rule := range notifier.Rules {
+				rulePath := fmt.Sprintf("%s.rules[%d]", path, ruleIndex)
+				if rule.Action != "" && !slices.Contains(RuleActions, rule.Action) {
+					add(rulePath+".action", "unknown action %q, available: %s", rule.Action, strings.Join(RuleActions, ", "))
+				}
+				if err := rule.TitleRegex.Err(); err != nil {
+					add(rulePath+".titleRegex", "invalid regular expression: %v", err)
+				}
+			}
+
+			policy := notifier.Message.MentionPolicy
+			policyPath := path + ".message.mentionPolicy"
+			if policy.Cooldown < 0 {
+				add(policyPath+".cooldown", "must be positive")
+			}
+			if policy.MaxPerDay < 0 {
+				add(policyPath+".maxPerDay", "must be positive")
+			}
+			if (policy.QuietHours.Start == "") != (policy.QuietHours.End == "") {
+				add(policyPath+".quietHours", "start and end must be both set")
+			}
+			for name, hour := range map[string]string{"start": policy.QuietHours.Start, "end": policy.QuietHours.End} {
+				if _, err := time.Parse(MentionPolicyHourLayout, hour); hour != "" && err != nil {
+					add(policyPath+".quietHours."+name, "must be formatted as HH:MM, got %q", hour)
+				}
+			}
+			if policy.QuietHours.Timezone.Err() != nil {
+				add(policyPath+".quietHours.timezone", "unknown timezone %q", policy.QuietHours.Timezone)
+			}
+		}
+	}
+
+	slices.SortStableFunc(problems, func(a, b ConfigProblem) int { return strings.Compare(a.Path, b.Path) })
+	return problems
+}
+
+func getSortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -1,21 +1,110 @@
 package domain
 
 import (
+	"errors"
 	"slices"
+	"time"
 )
 
 const (
-	DatabaseEventBucket   = "event"
-	DatabaseMessageBucket = "message"
+	DatabaseEventBucket     = "event"
+	DatabaseMessageBucket   = "message"
+	DatabaseMentionBucket   = "mention"
+	DatabaseNotifierBucket  = "notifier"
+	DatabaseSessionBucket   = "session"
+	DatabaseHistoryBucket   = "history"
+	DatabaseOutboxBucket    = "outbox"
+	DatabaseDeadBucket      = "dead"
+	DatabaseThreadBucket    = "thread"
+	DatabaseCrosspostBucket = "crosspost"
+	DatabaseBoardBucket     = "board"
 
-	ConfigFileName   = "config.yaml"
-	DatabaseFileName = "storage/database.db"
-	LogFileName      = "storage/log.txt"
+	DefaultConfigFileName   = "config.yaml"
+	DefaultDatabaseFileName = "storage/database.db"
+	DefaultLogFileName      = "storage/log.txt"
+
+	ConfigPathEnv       = "LIVESTATUS_CONFIG" // Overridden by the --config flag
+	ConfigEnvPrefix     = "LIVESTATUS_"       // LIVESTATUS_<SECTION>_<FIELD>, e.g. LIVESTATUS_TWITCH_CLIENT_SECRET
+	ConfigEnvFileSuffix = "_FILE"             // LIVESTATUS_<SECTION>_<FIELD>_FILE reads the value from a file
+
+	ConfigWatchInterval = 5 * time.Second
+
+	MetricsPath = "/metrics"
+
+	DiagnosticsStartupDelay   = 30 * time.Second // Lets the webhook server start before checking it
+	DiagnosticsInterval       = 6 * time.Hour
+	DiagnosticsWebhookTimeout = 10 * time.Second
+
+	ShutdownTimeout     = 25 * time.Second // Below the 30s stop_grace_period of docker-compose.yaml
+	ShutdownCronTimeout = 10 * time.Second // Running cron jobs, included in ShutdownTimeout
+)
+
+var (
+	ErrNotifierNotFound     = errors.New("notifier not found")
+	ErrNotifierInConfigFile = errors.New("notifier defined in the config file")
 )
 
 type Config struct {
-	Twitch  TwitchConfig  `yaml:"twitch"`
-	Discord DiscordConfig `yaml:"discord"`
+	Twitch    TwitchConfig    `yaml:"twitch"`
+	Discord   DiscordConfig   `yaml:"discord"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Log       LogConfig       `yaml:"log"`
+	Api       ApiConfig       `yaml:"api"`
+	Dashboard DashboardConfig `yaml:"dashboard"`
+}
+
+type StorageConfig struct {
+	Database string `yaml:"database"` // Defaults to DefaultDatabaseFileName
+	Log      string `yaml:"log"`      // Defaults to DefaultLogFileName
+}
+
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"` // Disabled by default
+	Address string `yaml:"address"` // Listen address of /metrics (e.g. ":9090"), required: the webhook port is public
+}
+
+type ApiConfig struct {
+	Enabled bool   `yaml:"enabled"` // Disabled by default
+	Address string `yaml:"address"` // Listen address of the admin API (e.g. ":9091"), empty to serve it with the webhook
+	Token   string `yaml:"token"`   // Bearer token of the admin API, reloaded without restart
+}
+
+type DashboardConfig struct {
+	Enabled      bool   `yaml:"enabled"`      // Disabled by default
+	Address      string `yaml:"address"`      // Listen address of the dashboard (e.g. ":9092"), empty to serve it with the webhook
+	PublicUrl    string `yaml:"publicUrl"`    // URL of DashboardPath seen by the browsers, the OAuth2 redirect is <publicUrl>/callback
+	ClientId     string `yaml:"clientId"`     // OAuth2 client of the Discord application
+	ClientSecret string `yaml:"clientSecret"` // OAuth2 secret of the Discord application
+}
+
+type LogConfig struct {
+	Format     string            `yaml:"format"`     // LogFormatText or LogFormatJson
+	Level      string            `yaml:"level"`      // debug, info, warn or error
+	Levels     map[string]string `yaml:"levels"`     // Override of Level by component, see LogComponents
+	MaxSize    int               `yaml:"maxSize"`    // Megabytes before rotating the log file, 0 to disable
+	MaxAge     time.Duration     `yaml:"maxAge"`     // Age of the log file before rotating it, 0 to disable
+	MaxBackups int               `yaml:"maxBackups"` // Rotated files kept, 0 to keep them all
+}
+
+// NewDefaultConfig returns the config with the default values of the optional fields, the yaml file is decoded on top of it
+func NewDefaultConfig() Config {
+	return Config{
+		Discord: DiscordConfig{
+			EventExtension: DefaultEventExtension,
+			Presence:       DiscordPresence{RotateInterval: DefaultPresenceRotateInterval},
+		},
+		Storage: StorageConfig{
+			Database: DefaultDatabaseFileName,
+			Log:      DefaultLogFileName,
+		},
+		Log: LogConfig{
+			Format:     LogFormatText,
+			Level:      "info",
+			MaxSize:    DefaultLogMaxSize,
+			MaxBackups: DefaultLogMaxBackups,
+		},
+	}
 }
 
 type TwitchConfig struct {
@@ -24,55 +113,85 @@ type TwitchConfig struct {
 	WebhookUrl    string `yaml:"webhookUrl"`
 	WebhookSecret string `yaml:"webhookSecret"`
 	WebhookPort   int    `yaml:"webhookPort"`
+	HelixUrl      string `yaml:"helixUrl"` // Optional, defaults to TwitchHelixBaseUrl
+	AuthUrl       string `yaml:"authUrl"`  // Optional, defaults to TwitchAuthBaseUrl
 
 	// Not in yaml, fill by code
 	UserResolver map[string]TwitchUserResolver
 }
 
 type TwitchUserResolver struct {
-	TwitchId          string
-	TwitchName        string
-	TwitchDisplayName string
+	TwitchId              string
+	TwitchName            string
+	TwitchDisplayName     string
+	TwitchProfileImageUrl string // Avatar of the webhook messages, see WebhookPolicy
 }
 
 type DiscordConfig struct {
-	Token   string                       `yaml:"token"`
-	Servers map[string][]DiscordNotifier `yaml:"servers"` // Key is guildId
+	Token          string                       `yaml:"token"`
+	EventExtension time.Duration                `yaml:"eventExtension"` // Scheduled end time of the live events ahead of now, defaults to DefaultEventExtension
+	Servers        map[string][]DiscordNotifier `yaml:"servers"`        // Key is guildId
+	Boards         map[string]DiscordBoard      `yaml:"boards"`         // Key is guildId, see DiscordBoard
+	Counters       map[string]DiscordCounter    `yaml:"counters"`       // Key is guildId, see DiscordCounter
+	Presence       DiscordPresence              `yaml:"presence"`
 }
 
 type DiscordNotifier struct {
-	TwitchId string `yaml:"twitchId"`
-	Lang     string `yaml:"lang"`
-	Event    struct {
-		Active bool `yaml:"active"`
+	TwitchId    string                    `yaml:"twitchId"`
+	Lang        string                    `yaml:"lang"`
+	StreamTypes map[string]StreamTypeRule `yaml:"streamTypes"` // Key is stream type, empty to only notify "live" streams
+	Rules       []NotificationRule        `yaml:"rules"`       // Evaluated in order, the first matching rule gives the action
+	Event       struct {
+		Active   bool `yaml:"active"`
+		Complete bool `yaml:"complete"` // Set the event to completed with the discord.event.ended texts when the stream ends, deleted otherwise
 	} `yaml:"event"`
 	Message struct {
-		Active        bool   `yaml:"active"`
-		Buttons       bool   `yaml:"buttons"`
-		ChannelId     string `yaml:"channelId"`
-		RoleMentionId string `yaml:"roleMentionId"`
+		Active        bool          `yaml:"active"`
+		Buttons       bool          `yaml:"buttons"`
+		ChannelId     string        `yaml:"channelId"`
+		RoleMentionId string        `yaml:"roleMentionId"`
+		MentionPolicy MentionPolicy `yaml:"mentionPolicy"`
+		Thread        ThreadPolicy  `yaml:"thread"`    // Forum channels always hold the message in a post
+		Crosspost     bool          `yaml:"crosspost"` // Publish the first message of a stream to the servers following the announcement channel
+		Webhook       WebhookPolicy `yaml:"webhook"`
 	} `yaml:"message"`
 }
 
-func (dc Config) GetAllTwitchLinkGroupByGuild() map[string][]TwitchUserResolver {
-	guildToTwitchLink := make(map[string][]TwitchUserResolver)
-	isContainsTwitchId := func(twitchId string) bool {
-		for _, twitchIds := range guildToTwitchLink {
-			for _, linkIdName := range twitchIds {
-				if linkIdName.TwitchId == twitchId {
-					return true
-				}
-			}
+type StreamTypeRule struct {
+	Template  string `yaml:"template"`  // Key of discord.embed.templates in i18n, empty to use discord.embed.online
+	NoMention bool   `yaml:"noMention"` // Post without roleMentionId
+}
+
+// GetStreamTypeRule returns the rule of a stream type, false if the stream type does not count as live for this notifier
+func (n DiscordNotifier) GetStreamTypeRule(streamType string) (StreamTypeRule, bool) {
+	if len(n.StreamTypes) == 0 {
+		return StreamTypeRule{}, streamType == StreamTypeLive
+	}
+	rule, ok := n.StreamTypes[streamType]
+	return rule, ok
+}
+
+// FilterLiveState returns the state as seen by this notifier, a stream type not accepted by the notifier is shown offline
+func (n DiscordNotifier) FilterLiveState(state LiveState) LiveState {
+	if state.IsOnline() {
+		if _, ok := n.GetStreamTypeRule(state.OnlineState.Type); !ok {
+			state.OnlineState.IsLive = false
 		}
-		return false
 	}
+	return state
+}
 
+func (dc Config) GetAllTwitchLinkGroupByGuild() map[string][]TwitchUserResolver {
+	guildToTwitchLink := make(map[string][]TwitchUserResolver)
 	for guildId, notifiers := range dc.Discord.Servers {
 		guildToTwitchLink[guildId] = make([]TwitchUserResolver, 0)
 
 		for _, notifier := range notifiers {
 			userResolver, ok := dc.Twitch.UserResolver[notifier.TwitchId]
-			if ok && !isContainsTwitchId(notifier.TwitchId) {
+			isContainsTwitchId := slices.ContainsFunc(guildToTwitchLink[guildId], func(link TwitchUserResolver) bool {
+				return link.TwitchId == notifier.TwitchId
+			})
+			if ok && !isContainsTwitchId {
 				guildToTwitchLink[guildId] = append(guildToTwitchLink[guildId], userResolver)
 			}
 		}
@@ -80,6 +199,40 @@ func (dc Config) GetAllTwitchLinkGroupByGuild() map[string][]TwitchUserResolver
 	return guildToTwitchLink
 }
 
+// MergeNotifiers returns a copy of the config with the notifiers stored in database, guildId as key.
+// A stored notifier replaces the yaml notifier of the same guild and streamer.
+func (dc Config) MergeNotifiers(storedServers map[string][]DiscordNotifier) *Config {
+	merged := dc
+	merged.Discord.Servers = make(map[string][]DiscordNotifier)
+	for guildId, notifiers := range dc.Discord.Servers {
+		merged.Discord.Servers[guildId] = slices.Clone(notifiers)
+	}
+
+	for guildId, storedNotifiers := range storedServers {
+		for _, storedNotifier := range storedNotifiers {
+			notifiers := merged.Discord.Servers[guildId]
+			index := slices.IndexFunc(notifiers, func(notifier DiscordNotifier) bool {
+				return notifier.TwitchId == storedNotifier.TwitchId
+			})
+			if index >= 0 {
+				notifiers[index] = storedNotifier
+			} else {
+				merged.Discord.Servers[guildId] = append(notifiers, storedNotifier)
+			}
+		}
+	}
+
+	return &merged
+}
+
+// GetGuildLang returns the lang of the first notifier of the guild, used for guild-wide texts like commands
+func (dc DiscordConfig) GetGuildLang(guildId string) string {
+	if notifiers, ok := dc.Servers[guildId]; ok && len(notifiers) > 0 && notifiers[0].Lang != "" {
+		return notifiers[0].Lang
+	}
+	return I18nDefaultLang
+}
+
 func (dc DiscordConfig) GetAllTwitchIds() []string {
 	var twitchIds []string
 	for _, notifiers := range dc.Servers {
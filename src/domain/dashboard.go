@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	DashboardPath          = "/dashboard"
+	DashboardSessionCookie = "livestatus_session"
+	DashboardStateCookie   = "livestatus_oauth_state"
+	DashboardSessionTtl    = 12 * time.Hour
+	DashboardStateTtl      = 10 * time.Minute // Time to log in on Discord
+	DashboardHttpTimeout   = 10 * time.Second
+
+	DiscordOAuthAuthorizeUrl = "https://discord.com/oauth2/authorize"
+	DiscordOAuthTokenUrl     = "https://discord.com/api/oauth2/token"
+	DiscordApiBaseUrl        = "https://discord.com/api/v10"
+	DiscordOAuthScopes       = "identify guilds"
+
+	HistoryMaxSessions      = 20 // By streamer
+	HistoryMaxNotifications = 50 // By guild
+
+	NotificationActionPosted  = "posted"
+	NotificationActionOffline = "offline"
+	NotificationActionDeleted = "deleted"
+)
+
+var (
+	ErrDashboardForbidden      = errors.New("the Manage Server permission is required")
+	ErrInvalidNotifierSettings = errors.New("invalid notifier settings")
+)
+
+// StreamSession is a stream of a streamer, EndedAt is nil while it is live
+type StreamSession struct {
+	StartedAt  time.Time  `json:"startedAt"`
+	EndedAt    *time.Time `json:"endedAt,omitempty"`
+	StreamType string     `json:"streamType"`
+	Title      string     `json:"title"`
+	GameName   string     `json:"gameName"`
+}
+
+// NotificationRecord is an announcement posted, marked offline or deleted in a guild
+type NotificationRecord struct {
+	Time      time.Time `json:"time"`
+	TwitchId  string    `json:"twitchId"`
+	ChannelId string    `json:"channelId"`
+	MessageId string    `json:"messageId"`
+	Action    string    `json:"action"` // One of NotificationAction*
+	Mention   bool      `json:"mention"`
+}
+
+// DiscordOAuthUser is the Discord user logged in the dashboard with the guilds returned by the guilds scope
+type DiscordOAuthUser struct {
+	Id       string              `json:"id"`
+	Username string              `json:"username"`
+	Avatar   string              `json:"avatar"`
+	Guilds   []DiscordOAuthGuild `json:"guilds"`
+}
+
+type DiscordOAuthGuild struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Icon        string `json:"icon"`
+	Owner       bool   `json:"owner"`
+	Permissions int64  `json:"permissions,string"`
+}
+
+// DashboardGuild is the state of a guild shown in the dashboard
+type DashboardGuild struct {
+	Id            string                     `json:"id"`
+	Name          string                     `json:"name"`
+	Langs         []string                   `json:"langs"`
+	Channels      []DashboardOption          `json:"channels"` // Text and announcement channels
+	Roles         []DashboardOption          `json:"roles"`
+	Notifiers     []DashboardNotifier        `json:"notifiers"`
+	Sessions      map[string][]StreamSession `json:"sessions"` // Key is twitchId, most recent first
+	Notifications []NotificationRecord       `json:"notifications"`
+}
+
+type DashboardOption struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type DashboardNotifier struct {
+	TwitchId    string                 `json:"twitchId"`
+	TwitchName  string                 `json:"twitchName"`
+	Source      string                 `json:"source"` // config or discord, like /livestatus list
+	Online      bool                   `json:"online"`
+	StreamTitle string                 `json:"streamTitle,omitempty"`
+	GameName    string                 `json:"gameName,omitempty"`
+	Settings    DashboardNotifierInput `json:"settings"`
+}
+
+// DashboardNotifierInput holds the notifier settings editable in the dashboard, the same as /livestatus set
+type DashboardNotifierInput struct {
+	ChannelId     string `json:"channelId"`
+	RoleMentionId string `json:"roleMentionId"`
+	Lang          string `json:"lang"`
+	Buttons       bool   `json:"buttons"`
+	Event         bool   `json:"event"`
+	Message       bool   `json:"message"`
+}
+
+// Apply copies the settings on the notifier
+func (i DashboardNotifierInput) Apply(notifier *DiscordNotifier) {
+	notifier.Message.ChannelId = i.ChannelId
+	notifier.Message.RoleMentionId = i.RoleMentionId
+	notifier.Lang = i.Lang
+	notifier.Message.Buttons = i.Buttons
+	notifier.Event.Active = i.Event
+	notifier.Message.Active = i.Message
+}
+
+func NewDashboardNotifierInput(notifier DiscordNotifier) DashboardNotifierInput {
+	return DashboardNotifierInput{
+		ChannelId:     notifier.Message.ChannelId,
+		RoleMentionId: notifier.Message.RoleMentionId,
+		Lang:          notifier.Lang,
+		Buttons:       notifier.Message.Buttons,
+		Event:         notifier.Event.Active,
+		Message:       notifier.Message.Active,
+	}
+}
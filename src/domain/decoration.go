@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+const (
+	DecorationDebounceDelay       = 10 * time.Second // Changes within the delay are grouped in a single update
+	ChannelRenameLimit            = 2                // Renames of a channel allowed by Discord within ChannelRenameWindow
+	ChannelRenameWindow           = 10 * time.Minute
+	DefaultPresenceRotateInterval = time.Minute
+	MinPresenceRotateInterval     = 30 * time.Second // Discord allows 5 presence updates per minute
+)
+
+// DiscordCounter is a voice or category channel of a guild renamed with the number of live streamers of its notifiers
+type DiscordCounter struct {
+	ChannelId string `yaml:"channelId"`
+	Lang      string `yaml:"lang"`
+}
+
+// DiscordPresence shows the live streamers in the status of the bot, one at a time
+type DiscordPresence struct {
+	Active         bool          `yaml:"active"`
+	RotateInterval time.Duration `yaml:"rotateInterval"` // Delay before showing the next live streamer, defaults to DefaultPresenceRotateInterval
+}
@@ -8,17 +8,64 @@ import (
 const (
 	LiveCommandName = "live"
 
+	AdminCommandName       = "livestatus"
+	AdminSubcommandAdd     = "add"
+	AdminSubcommandRemove  = "remove"
+	AdminSubcommandList    = "list"
+	AdminSubcommandSet     = "set"
+	AdminSubcommandCheck   = "check"
+	AdminOptionStreamer    = "streamer"
+	AdminOptionChannel     = "channel"
+	AdminOptionRole        = "role"
+	AdminOptionClearRole   = "clear_role"
+	AdminOptionLang        = "lang"
+	AdminOptionButtons     = "buttons"
+	AdminOptionEvent       = "event"
+	AdminOptionMessage     = "message"
+	AdminCommandMaxChoices = 25
+
 	EmbedColorOffline  = 9807270
 	EmbedColorOnline   = 10181046
 	EmbedFooterIconUrl = "https://i.imgur.com/Qo9ZWge.png"
 
-	everyoneMention = "everyone"
-	hereMention     = "here"
+	EveryoneMention = "everyone"
+	HereMention     = "here"
+
+	DefaultEventExtension     = 30 * time.Minute // Scheduled end time of a live event ahead of now, see DiscordConfig.EventExtension
+	MinEventExtension         = 5 * time.Minute  // Leaves a few refreshes to renew the event before it ends
+	EventRenewRatio           = 2                // The end time is renewed once less than EventExtension / EventRenewRatio is left
+	EventEndJitterRatio       = 4                // Up to EventExtension / EventEndJitterRatio is removed from the end time to spread the renewals
+	EventDescriptionMaxLength = 1000
+	EventDescriptionMarker    = "\n\n-# LiveStatus" // Ends the description of the events, finds the events left active by a crash
+
+	MessageMaxLength = 2000
 
-	FakeEndDateDelay = 2 * time.Minute
+	EmbedMaxLength           = 6000 // Title, description, fields and footer of an embed together
+	EmbedFieldNameMaxLength  = 256
+	EmbedFieldValueMaxLength = 1024
+
+	DiscordDispatchConcurrency  = 8                      // Discord calls in flight for a fan-out, and outbox workers
+	DiscordGlobalRateLimit      = 50                     // Requests per second allowed for a bot
+	DiscordBucketMaxWait        = time.Second            // Tasks waiting for their bucket check it again at least this often
+	DiscordBucketBusyWait       = 100 * time.Millisecond // Bucket locked by a request in flight
+	DiscordPriorityAnnouncement = 0                      // New messages and events, delivered first
+	DiscordPriorityUpdate       = 1                      // Edits and deletions
 )
 
 var (
-	CustomMentions    = []string{everyoneMention, hereMention}
-	EventStatusToSkip = []discordgo.GuildScheduledEventStatus{discordgo.GuildScheduledEventStatusCanceled, discordgo.GuildScheduledEventStatusCompleted}
+	CustomMentions      = []string{EveryoneMention, HereMention}
+	EventGoneErrorCodes = []int{discordgo.ErrCodeUnknownGuildScheduledEvent, discordgo.ErrCodeCannotUpdateAFinishedEvent} // The event is created again
 )
+
+// DiscordEventRecord is the stored scheduled event of a streamer in a guild, with what was last sent to Discord
+type DiscordEventRecord struct {
+	Id          string    `json:"id"`
+	EndTime     time.Time `json:"endTime"`     // Scheduled end time of the event, zero for the events stored as a bare id
+	ContentHash string    `json:"contentHash"` // Name, description and location
+	ImageHash   string    `json:"imageHash"`   // Stream and game of the cover image, uploaded again only when they changed
+}
+
+// NeedsRenewal reports whether the end time is close enough to be pushed forward, see EventRenewRatio
+func (r DiscordEventRecord) NeedsRenewal(extension time.Duration) bool {
+	return time.Until(r.EndTime) < extension/EventRenewRatio
+}
@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+const (
+	HealthPath = "/healthz" // Process alive
+	ReadyPath  = "/readyz"  // Dependencies ready, see ReadinessReport
+
+	HealthcheckTimeout          = 5 * time.Second
+	HealthSubscriptionsCacheTtl = time.Minute // Readiness probes must not exhaust the Helix rate limit
+	HealthCronGracePeriod       = time.Minute // Covers the retries of a cron job before it is considered late
+
+	ReadinessDiscord       = "discord"
+	ReadinessTwitchToken   = "twitchToken"
+	ReadinessSubscriptions = "subscriptions"
+	ReadinessDatabase      = "database"
+	ReadinessCronPrefix    = "cron."
+
+	CronRefreshDiscordEvent   = "refreshDiscordEvent"
+	CronRefreshTwitchStreams  = "refreshTwitchStreams"
+	CronArchiveDiscordThreads = "archiveDiscordThreads"
+
+	CronRefreshDiscordEventInterval   = time.Minute
+	CronRefreshTwitchStreamsInterval  = 5 * time.Minute
+	CronArchiveDiscordThreadsInterval = time.Minute
+
+	ReadinessOk = "ok"
+)
+
+// TwitchSubscriptionStatus is the state of an EventSub subscription on Twitch
+type TwitchSubscriptionStatus struct {
+	BroadcasterId string `json:"broadcasterId"`
+	Type          string `json:"type"`
+	Status        string `json:"status"`
+}
+
+// ReadinessReport holds ReadinessOk or the failure of every check. ReadyPath is on the public webhook port and only
+// answers Ready, the checks are served by the admin API
+type ReadinessReport struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
@@ -7,15 +7,47 @@ const (
 
 type I18nMessages struct {
 	Discord struct {
-		Event       DiscordEventI18n       `yaml:"event"`
-		LiveCommand DiscordLiveCommandI18n `yaml:"liveCommand"`
-		Embed       DiscordEmbedI18n       `yaml:"embed"`
+		Event        DiscordEventI18n        `yaml:"event"`
+		LiveCommand  DiscordLiveCommandI18n  `yaml:"liveCommand"`
+		AdminCommand DiscordAdminCommandI18n `yaml:"adminCommand"`
+		Embed        DiscordEmbedI18n        `yaml:"embed"`
+		Thread       DiscordThreadI18n       `yaml:"thread"`
+		Board        DiscordBoardI18n        `yaml:"board"`
+		Counter      DiscordCounterI18n      `yaml:"counter"`
 	} `yaml:"discord"`
 }
 
 type DiscordEventI18n struct {
 	Title       string `yaml:"title"`
 	Description string `yaml:"description"`
+	Ended       struct {
+		Title       string `yaml:"title"`
+		Description string `yaml:"description"`
+	} `yaml:"ended"` // Texts of the completed events, see DiscordNotifier.Event.Complete
+}
+
+// DiscordThreadI18n holds the texts of the stream threads, see ThreadPolicy. The recap also has the %duration% variable,
+// the raid has the %target%, %targetUrl% and %viewers% variables
+type DiscordThreadI18n struct {
+	Name        string `yaml:"name"`
+	GameChanged string `yaml:"gameChanged"`
+	Raid        string `yaml:"raid"`
+	Recap       string `yaml:"recap"`
+}
+
+// DiscordBoardI18n holds the texts of the board, see DiscordBoard. The title and more have the %count% variable, the
+// entries also have the %viewers% and %uptime% variables and are named with the online embed title of the stream
+type DiscordBoardI18n struct {
+	Title string `yaml:"title"`
+	Empty string `yaml:"empty"`
+	Entry string `yaml:"entry"`
+	More  string `yaml:"more"` // Live streamers left out of a full board
+}
+
+// DiscordCounterI18n holds the names of the counter channel, see DiscordCounter. The name has the %count% variable
+type DiscordCounterI18n struct {
+	Name  string `yaml:"name"`
+	Empty string `yaml:"empty"`
 }
 
 type DiscordLiveCommandI18n struct {
@@ -28,19 +60,45 @@ type DiscordLiveCommandI18n struct {
 	AppError         string `yaml:"appError"`
 }
 
+type DiscordAdminCommandI18n struct {
+	Description      string            `yaml:"description"`
+	Subcommands      map[string]string `yaml:"subcommands"` // Subcommand name as key, description as value
+	Options          map[string]string `yaml:"options"`     // Option name as key, description as value
+	Added            string            `yaml:"added"`
+	Updated          string            `yaml:"updated"`
+	Removed          string            `yaml:"removed"`
+	List             string            `yaml:"list"`
+	ListEmpty        string            `yaml:"listEmpty"`
+	ListMore         string            `yaml:"listMore"` // Notifiers left out of a long list, has the %count% variable
+	StreamerNotFound string            `yaml:"streamerNotFound"`
+	NotifierNotFound string            `yaml:"notifierNotFound"`
+	NotifierExists   string            `yaml:"notifierExists"`
+	NotifierInConfig string            `yaml:"notifierInConfig"`
+	CheckOk          string            `yaml:"checkOk"`
+	CheckProblems    string            `yaml:"checkProblems"`
+	Forbidden        string            `yaml:"forbidden"`
+	AppError         string            `yaml:"appError"`
+}
+
 type DiscordEmbedI18n struct {
-	Online struct {
-		Title       string         `yaml:"title"`
-		Description string         `yaml:"description"`
-		Button      DiscordButton  `yaml:"button"`
-		Fields      []DiscordField `yaml:"fields"`
-	} `yaml:"online"`
-	Offline struct {
-		Title       string         `yaml:"title"`
-		Description string         `yaml:"description"`
-		Button      DiscordButton  `yaml:"button"`
-		Fields      []DiscordField `yaml:"fields"`
-	} `yaml:"offline"`
+	Online    DiscordEmbedStateI18n            `yaml:"online"`
+	Offline   DiscordEmbedStateI18n            `yaml:"offline"`
+	Templates map[string]DiscordEmbedStateI18n `yaml:"templates"` // Replace online for a stream type, see StreamTypeRule
+}
+
+type DiscordEmbedStateI18n struct {
+	Title       string         `yaml:"title"`
+	Description string         `yaml:"description"`
+	Button      DiscordButton  `yaml:"button"`
+	Fields      []DiscordField `yaml:"fields"`
+}
+
+// GetOnline returns the online template, falling back to Online when the template is unknown
+func (e DiscordEmbedI18n) GetOnline(template string) DiscordEmbedStateI18n {
+	if embed, ok := e.Templates[template]; ok && template != "" {
+		return embed
+	}
+	return e.Online
 }
 
 type DiscordField struct {
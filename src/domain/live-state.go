@@ -1,13 +1,11 @@
 package domain
 
 import (
-	"encoding/base64"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,30 +13,55 @@ const (
 	StreamImageWidth  = 1920
 	StreamImageHeight = 1080
 
-	baseGameUrl         = "https://static-cdn.jtvnw.net/ttv-boxart"
+	StreamEventImageWidth  = 1280 // Downloaded thumbnail size, used as scheduled event cover
+	StreamEventImageHeight = 720
+
 	GameThumbnailWidth  = 288
 	GameThumbnailHeight = 384
 
+	GameImageCacheTtl   = 24 * time.Hour
+	StreamImageCacheTtl = 5 * time.Minute // Twitch refreshes live thumbnails every 5 minutes
+
+	StreamTypeLive       = "live"
+	StreamTypePlaylist   = "playlist"
+	StreamTypeWatchParty = "watch_party"
+	StreamTypePremiere   = "premiere"
+	StreamTypeRerun      = "rerun"
+
 	ChannelUpdate = "channel.update"
 	StreamOnline  = "stream.online"
 	StreamOffline = "stream.offline"
+	ChannelRaid   = "channel.raid" // Raids started by the broadcaster, the condition is from_broadcaster_user_id
 )
 
 var (
-	SubscriptionList = []string{ChannelUpdate, StreamOnline, StreamOffline}
+	SubscriptionList = []string{ChannelUpdate, StreamOnline, StreamOffline, ChannelRaid}
+	StreamTypes      = []string{StreamTypeLive, StreamTypePlaylist, StreamTypeWatchParty, StreamTypePremiere, StreamTypeRerun}
 )
 
+// ImageResolver resolves the images of a stream, implementations are expected to cache them
+type ImageResolver interface {
+	GetStreamImage(thumbnailUrl string) (string, error) // data URL of the thumbnail, thumbnailUrl keeps its {width}x{height} placeholders
+	GetGameImageUrl(gameId string) (string, error)
+}
+
 type LiveState struct {
-	TriggerFunction func(LiveState) error
+	TriggerFunction func(LiveState) error `json:"-"`
+	ImageResolver   ImageResolver         `json:"-"`
 	TwitchId        string
 	TwitchName      string
+	EventStreamType string // Type of the last stream.online EventSub notification, empty when unknown
 	OnlineState     OnlineState
 }
 
 type OnlineState struct {
 	IsLive            bool
+	Type              string // One of StreamTypes
 	GameName          string
 	Title             string
+	Tags              []string
+	Language          string
+	IsMature          bool
 	ViewerCount       int
 	StartedAt         time.Time
 	StreamImageUrl    string
@@ -46,6 +69,58 @@ type OnlineState struct {
 	GameImageUrl      string
 }
 
+// LiveStates is the concurrency-safe set of followed streamers, twitchId as key
+type LiveStates struct {
+	mu     sync.RWMutex
+	states map[string]*LiveState
+}
+
+func NewLiveStates() *LiveStates {
+	return &LiveStates{
+		states: make(map[string]*LiveState),
+	}
+}
+
+func (s *LiveStates) Get(twitchId string) (*LiveState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.states[twitchId]
+	return state, ok
+}
+
+func (s *LiveStates) Set(state *LiveState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.TwitchId] = state
+}
+
+func (s *LiveStates) Delete(twitchId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, twitchId)
+}
+
+// All returns a snapshot of the states, twitchId as key
+func (s *LiveStates) All() map[string]*LiveState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	states := make(map[string]*LiveState, len(s.states))
+	for twitchId, state := range s.states {
+		states[twitchId] = state
+	}
+	return states
+}
+
+func (s *LiveStates) TwitchIds() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	twitchIds := make([]string, 0, len(s.states))
+	for twitchId := range s.states {
+		twitchIds = append(twitchIds, twitchId)
+	}
+	return twitchIds
+}
+
 func (l *LiveState) IsOnline() bool {
 	return l.OnlineState.IsLive
 }
@@ -67,7 +142,13 @@ func (l *LiveState) SetLiveState(twResponse *TwitchStreamResponse) error {
 	l.OnlineState.IsLive = twResponse != nil && twResponse.Type == twitchTypeLive
 
 	if l.IsOnline() && twResponse != nil {
-		err := l.updateOnlineState(twResponse.GameName, twResponse.Title, twResponse.ViewerCount, twResponse.StartedAt, twResponse.ThumbnailUrl, twResponse.GameId)
+		// Helix only reports "live", the EventSub notification carries the real stream type
+		l.OnlineState.Type = StreamTypeLive
+		if l.EventStreamType != "" {
+			l.OnlineState.Type = l.EventStreamType
+		}
+
+		err := l.updateOnlineState(twResponse)
 		if err != nil {
 			return err
 		}
@@ -80,71 +161,39 @@ func (l *LiveState) SetLiveState(twResponse *TwitchStreamResponse) error {
 	return nil
 }
 
-func (l *LiveState) updateOnlineState(gameName string, title string, viewerCount int, startedAt time.Time, streamImageUrl string, gameId string) error {
-	streamImageUrl = strings.Replace(strings.Replace(streamImageUrl,
-		"{width}", fmt.Sprintf("%d", StreamImageWidth), 1),
-		"{height}", fmt.Sprintf("%d", StreamImageHeight), 1,
-	)
-	streamImgBase64, err := getBlobImg(streamImageUrl)
-	if err != nil {
-		return err
-	}
+func (l *LiveState) updateOnlineState(twResponse *TwitchStreamResponse) error {
+	thumbnailUrl := twResponse.ThumbnailUrl
+	streamImageUrl := FormatTwitchImageUrl(thumbnailUrl, StreamImageWidth, StreamImageHeight)
 
-	gameImageUrl, err := getGameImageUrl(gameId)
-	if err != nil {
-		return err
+	var streamImgBase64, gameImageUrl string
+	if l.ImageResolver != nil {
+		var err error
+		if streamImgBase64, err = l.ImageResolver.GetStreamImage(thumbnailUrl); err != nil {
+			return err
+		}
+		if gameImageUrl, err = l.ImageResolver.GetGameImageUrl(twResponse.GameId); err != nil {
+			return err
+		}
 	}
 
-	l.OnlineState.GameName = gameName
-	l.OnlineState.Title = title
-	l.OnlineState.ViewerCount = viewerCount
-	l.OnlineState.StartedAt = startedAt
+	l.OnlineState.GameName = twResponse.GameName
+	l.OnlineState.Title = twResponse.Title
+	l.OnlineState.Tags = twResponse.Tags
+	l.OnlineState.Language = twResponse.Language
+	l.OnlineState.IsMature = twResponse.IsMature
+	l.OnlineState.ViewerCount = twResponse.ViewerCount
+	l.OnlineState.StartedAt = twResponse.StartedAt
 	l.OnlineState.StreamImageUrl = streamImageUrl
-	l.OnlineState.StreamImageBase64 = *streamImgBase64
-	l.OnlineState.GameImageUrl = *gameImageUrl
+	l.OnlineState.StreamImageBase64 = streamImgBase64
+	l.OnlineState.GameImageUrl = gameImageUrl
 
 	return nil
 }
 
-func getGameImageUrl(gameId string) (*string, error) {
-	igdbImgUrl := fmt.Sprintf("%s/%s_IGDB-%dx%d.jpg", baseGameUrl, url.PathEscape(gameId), GameThumbnailWidth, GameThumbnailHeight)
-	twitchImgUrl := fmt.Sprintf("%s/%s-%dx%d.jpg", baseGameUrl, url.PathEscape(gameId), GameThumbnailWidth, GameThumbnailHeight)
-
-	req, err := http.NewRequest("GET", igdbImgUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	if resp.StatusCode == http.StatusOK {
-		return &igdbImgUrl, nil
-	} else {
-		return &twitchImgUrl, nil
-	}
-}
-
-func getBlobImg(url string) (*string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	base64String := base64.StdEncoding.EncodeToString(body)
-	dataURL := fmt.Sprintf("data:image/jpeg;base64,%s", base64String)
-	return &dataURL, nil
+// FormatTwitchImageUrl replaces the {width} and {height} placeholders of Twitch thumbnail and box art URLs
+func FormatTwitchImageUrl(imageUrl string, width int, height int) string {
+	return strings.Replace(strings.Replace(imageUrl,
+		"{width}", fmt.Sprintf("%d", width), 1),
+		"{height}", fmt.Sprintf("%d", height), 1,
+	)
 }
@@ -0,0 +1,20 @@
+package domain
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+
+	DefaultLogMaxSize    = 10 // Megabytes
+	DefaultLogMaxBackups = 5
+
+	LogComponentTwitch  = "twitch"
+	LogComponentDiscord = "discord"
+	LogComponentCron    = "cron"
+	LogComponentConfig  = "config"
+	LogComponentHttp    = "http"
+)
+
+var (
+	LogFormats    = []string{LogFormatText, LogFormatJson}
+	LogComponents = []string{LogComponentTwitch, LogComponentDiscord, LogComponentCron, LogComponentConfig, LogComponentHttp}
+)
@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	MentionPolicyDayLayout  = "2006-01-02"
+	MentionPolicyHourLayout = "15:04"
+)
+
+type MentionPolicy struct {
+	Cooldown   time.Duration `yaml:"cooldown"`  // Minimum delay since the last mention, 0 to disable
+	MaxPerDay  int           `yaml:"maxPerDay"` // 0 to disable
+	QuietHours struct {
+		Start    string   `yaml:"start"`    // HH:MM
+		End      string   `yaml:"end"`      // HH:MM, can be before start to span midnight
+		Timezone Timezone `yaml:"timezone"` // IANA name, UTC when empty
+	} `yaml:"quietHours"`
+}
+
+// MentionHistory is stored by channel and streamer to enforce the MentionPolicy
+type MentionHistory struct {
+	LastMentionAt time.Time `json:"lastMentionAt"`
+	Day           string    `json:"day"` // Day of Count in the policy timezone
+	Count         int       `json:"count"`
+}
+
+// Timezone is the loaded location of the quiet hours
+type Timezone struct {
+	name     string
+	location *time.Location // nil when the name is empty or unknown
+	err      error
+}
+
+func NewTimezone(name string) Timezone {
+	timezone := Timezone{name: name}
+	if name != "" {
+		timezone.location, timezone.err = time.LoadLocation(name)
+	}
+	return timezone
+}
+
+func (t Timezone) String() string {
+	return t.name
+}
+
+// Err returns the error of an unknown name, reported by Validate
+func (t Timezone) Err() error {
+	return t.err
+}
+
+func (t Timezone) MarshalYAML() (any, error) {
+	return t.name, nil
+}
+
+func (t *Timezone) UnmarshalYAML(unmarshal func(any) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	*t = NewTimezone(name)
+	return nil
+}
+
+func (t Timezone) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.name)
+}
+
+func (t *Timezone) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	*t = NewTimezone(name)
+	return nil
+}
+
+// Location returns the resolved timezone, UTC when empty
+func (p MentionPolicy) Location() *time.Location {
+	if p.QuietHours.Timezone.location == nil {
+		return time.UTC
+	}
+	return p.QuietHours.Timezone.location
+}
+
+func (p MentionPolicy) IsQuietHour(now time.Time) bool {
+	if p.QuietHours.Start == "" || p.QuietHours.End == "" {
+		return false
+	}
+
+	start, err := time.Parse(MentionPolicyHourLayout, p.QuietHours.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(MentionPolicyHourLayout, p.QuietHours.End)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(p.Location())
+	minutes := local.Hour()*60 + local.Minute()
+	startMinutes := start.Hour()*60 + start.Minute()
+	endMinutes := end.Hour()*60 + end.Minute()
+	if startMinutes <= endMinutes {
+		return minutes >= startMinutes && minutes < endMinutes
+	}
+	return minutes >= startMinutes || minutes < endMinutes
+}
+
+// Allows tells if a mention can be sent now given the previous mentions
+func (p MentionPolicy) Allows(now time.Time, history MentionHistory) bool {
+	if p.IsQuietHour(now) {
+		return false
+	}
+	if p.Cooldown > 0 && !history.LastMentionAt.IsZero() && now.Sub(history.LastMentionAt) < p.Cooldown {
+		return false
+	}
+	if p.MaxPerDay > 0 && history.Day == now.In(p.Location()).Format(MentionPolicyDayLayout) && history.Count >= p.MaxPerDay {
+		return false
+	}
+	return true
+}
+
+// Record returns the history after a mention sent now
+func (p MentionPolicy) Record(now time.Time, history MentionHistory) MentionHistory {
+	day := now.In(p.Location()).Format(MentionPolicyDayLayout)
+	if history.Day != day {
+		history.Day = day
+		history.Count = 0
+	}
+	history.Count++
+	history.LastMentionAt = now
+	return history
+}
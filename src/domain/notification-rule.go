@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	RuleActionPost      = "post"
+	RuleActionNoMention = "noMention"
+	RuleActionSilent    = "silent"
+)
+
+var (
+	RuleActions = []string{RuleActionPost, RuleActionNoMention, RuleActionSilent}
+)
+
+// NotificationRule matches when every non-empty criterion matches, an empty rule matches every stream
+type NotificationRule struct {
+	Games      []string   `yaml:"games"`      // Game names, case-insensitive
+	TitleRegex TitleRegex `yaml:"titleRegex"` // Go regexp matched against the title
+	Tags       []string   `yaml:"tags"`       // Matches when the stream has one of these tags, case-insensitive
+	Languages  []string   `yaml:"languages"`  // ISO 639-1 broadcast languages
+	IsMature   *bool      `yaml:"isMature"`
+	Action     string     `yaml:"action"` // One of RuleActions
+}
+
+// TitleRegex is the compiled titleRegex of a rule, an invalid pattern never matches
+type TitleRegex struct {
+	pattern string
+	regex   *regexp.Regexp
+	err     error
+}
+
+func NewTitleRegex(pattern string) TitleRegex {
+	titleRegex := TitleRegex{pattern: pattern}
+	if pattern != "" {
+		titleRegex.regex, titleRegex.err = regexp.Compile(pattern)
+	}
+	return titleRegex
+}
+
+func (t TitleRegex) String() string {
+	return t.pattern
+}
+
+// Err returns the compile error of the pattern, reported by Validate
+func (t TitleRegex) Err() error {
+	return t.err
+}
+
+func (t TitleRegex) MarshalYAML() (any, error) {
+	return t.pattern, nil
+}
+
+func (t *TitleRegex) UnmarshalYAML(unmarshal func(any) error) error {
+	var pattern string
+	if err := unmarshal(&pattern); err != nil {
+		return err
+	}
+	*t = NewTitleRegex(pattern)
+	return nil
+}
+
+func (t TitleRegex) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.pattern)
+}
+
+func (t *TitleRegex) UnmarshalJSON(data []byte) error {
+	var pattern string
+	if err := json.Unmarshal(data, &pattern); err != nil {
+		return err
+	}
+	*t = NewTitleRegex(pattern)
+	return nil
+}
+
+func (r NotificationRule) Matches(state OnlineState) bool {
+	if len(r.Games) > 0 && !slices.ContainsFunc(r.Games, func(game string) bool { return strings.EqualFold(game, state.GameName) }) {
+		return false
+	}
+
+	if r.TitleRegex.pattern != "" && (r.TitleRegex.regex == nil || !r.TitleRegex.regex.MatchString(state.Title)) {
+		return false
+	}
+
+	if len(r.Tags) > 0 && !slices.ContainsFunc(r.Tags, func(tag string) bool {
+		return slices.ContainsFunc(state.Tags, func(streamTag string) bool { return strings.EqualFold(tag, streamTag) })
+	}) {
+		return false
+	}
+
+	if len(r.Languages) > 0 && !slices.ContainsFunc(r.Languages, func(lang string) bool { return strings.EqualFold(lang, state.Language) }) {
+		return false
+	}
+
+	if r.IsMature != nil && *r.IsMature != state.IsMature {
+		return false
+	}
+
+	return true
+}
+
+// EvaluateRules returns the action of the first matching rule, RuleActionPost when no rule matches
+func (n DiscordNotifier) EvaluateRules(state LiveState) string {
+	for _, rule := range n.Rules {
+		if rule.Matches(state.OnlineState) {
+			if rule.Action == "" {
+				return RuleActionPost
+			}
+			return rule.Action
+		}
+	}
+	return RuleActionPost
+}
+
+// ShouldMention tells if an online message of this notifier must ping roleMentionId
+func (n DiscordNotifier) ShouldMention(state LiveState) bool {
+	rule, _ := n.GetStreamTypeRule(state.OnlineState.Type)
+	return !rule.NoMention && n.EvaluateRules(state) == RuleActionPost
+}
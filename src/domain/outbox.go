@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	OutboxIntentSend   = "send"   // Post the announcement, edited instead when a message is already stored
+	OutboxIntentEdit   = "edit"   // Edit the stored announcement, posted instead when it was deleted and the stream is online
+	OutboxIntentDelete = "delete" // Delete the stored announcement
+
+	OutboxPollInterval   = 5 * time.Second // Wake up for the jobs waiting for their backoff
+	OutboxMaxAttempts    = 10
+	OutboxInitialBackoff = 5 * time.Second
+	OutboxMaxBackoff     = 15 * time.Minute
+	OutboxMaxDeadLetters = 100 // Oldest dropped first
+)
+
+var ErrOutboxJobNotFound = errors.New("outbox job not found")
+
+// OutboxJob is a Discord announcement update of a notifier, stored until it is delivered or given up as a dead letter
+type OutboxJob struct {
+	Id            uint64          `json:"id"`  // Increasing, jobs of a notifier are delivered in order
+	Key           string          `json:"key"` // Idempotency key, the same transition is not queued twice while pending
+	Intent        string          `json:"intent"`
+	GuildId       string          `json:"guildId"`
+	Notifier      DiscordNotifier `json:"notifier"` // Settings when the job was queued
+	State         LiveState       `json:"state"`    // Filtered by the notifier, without StreamImageBase64
+	Attempts      int             `json:"attempts"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	LastError     string          `json:"lastError,omitempty"`
+}
+
+func NewOutboxJob(intent string, guildId string, notifier DiscordNotifier, state LiveState) OutboxJob {
+	state.OnlineState.StreamImageBase64 = "" // Only used by scheduled events
+	job := OutboxJob{
+		Intent:    intent,
+		GuildId:   guildId,
+		Notifier:  notifier,
+		State:     state,
+		CreatedAt: time.Now(),
+	}
+
+	transition, _ := json.Marshal(struct {
+		Notifier DiscordNotifier
+		State    LiveState
+	}{notifier, state})
+	hash := sha256.Sum256(transition)
+	job.Key = fmt.Sprintf("%s-%s-%s-%s", intent, notifier.TwitchId, notifier.Message.ChannelId, hex.EncodeToString(hash[:8]))
+	return job
+}
+
+// NotifierKey identifies the announcement updated by the job, like the message bucket key
+func (j OutboxJob) NotifierKey() string {
+	return fmt.Sprintf("%s-%s", j.Notifier.TwitchId, j.Notifier.Message.ChannelId)
+}
+
+// GetPriority ranks the first announcement of a stream above the edits, see DiscordPriorityAnnouncement
+func (j OutboxJob) GetPriority() int {
+	if j.Intent == OutboxIntentSend {
+		return DiscordPriorityAnnouncement
+	}
+	return DiscordPriorityUpdate
+}
+
+// GetBackoff returns the delay before the next attempt, doubled on every failed attempt
+func (j OutboxJob) GetBackoff() time.Duration {
+	backoff := OutboxInitialBackoff
+	for attempt := 1; attempt < j.Attempts && backoff < OutboxMaxBackoff; attempt++ {
+		backoff *= 2
+	}
+	return min(backoff, OutboxMaxBackoff)
+}
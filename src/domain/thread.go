@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+const (
+	DefaultThreadArchiveAfter = time.Hour
+	ThreadAutoArchiveDuration = 1440 // Minutes of inactivity before Discord archives the thread on its own, the maximum
+	ThreadNameMaxLength       = 100
+)
+
+// ThreadPolicy opens a discussion thread on the announcement, game changes, raids and the recap of the stream are posted in it
+type ThreadPolicy struct {
+	Active       bool          `yaml:"active"`
+	ArchiveAfter time.Duration `yaml:"archiveAfter"` // Delay after the stream before the thread is archived and locked, DefaultThreadArchiveAfter when 0
+}
+
+// GetArchiveAfter returns ArchiveAfter or its default
+func (p ThreadPolicy) GetArchiveAfter() time.Duration {
+	if p.ArchiveAfter <= 0 {
+		return DefaultThreadArchiveAfter
+	}
+	return p.ArchiveAfter
+}
+
+// DiscordThread is the thread of a stream announcement, or the forum post holding it
+type DiscordThread struct {
+	Id        string    `json:"id"`
+	TwitchId  string    `json:"twitchId"`
+	ChannelId string    `json:"channelId"` // Notifier channel, the forum of a forum post
+	Forum     bool      `json:"forum"`     // The announcement is the first message of the post, with the same id
+	GameName  string    `json:"gameName"`  // Last game announced in the thread
+	ArchiveAt time.Time `json:"archiveAt"` // Archive and lock time once the stream ended, zero while live
+}
+
+// IsEnded reports whether the recap was posted, the thread only waits to be archived
+func (t DiscordThread) IsEnded() bool {
+	return !t.ArchiveAt.IsZero()
+}
+
+// GetMessageChannelId returns the channel of the announcement, the post itself for the first message of a forum post
+func (t DiscordThread) GetMessageChannelId(channelId string, messageId string) string {
+	if t.Forum && t.Id == messageId {
+		return t.Id
+	}
+	return channelId
+}
+
+// TwitchRaid is a raid started by a followed broadcaster, posted in the thread of its stream
+type TwitchRaid struct {
+	FromTwitchId        string
+	ToTwitchName        string // Login of the raided broadcaster
+	ToTwitchDisplayName string
+	Viewers             int
+}
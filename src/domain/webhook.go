@@ -0,0 +1,26 @@
+package domain
+
+import "regexp"
+
+const WebhookName = "LiveStatus" // Name of the webhooks created by the bot, the messages are posted with the streamer name
+
+var webhookUrlRegex = regexp.MustCompile(`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/api(?:/v\d+)?/webhooks/(\d{17,20})/([\w-]+)$`)
+
+// WebhookPolicy posts the messages through a channel webhook with the name and avatar of the streamer, instead of the bot user
+type WebhookPolicy struct {
+	Active bool   `yaml:"active"` // Use a webhook of the channel created by the bot
+	Url    string `yaml:"url"`    // Use this webhook instead, the bot does not need to be in the server
+}
+
+func (p WebhookPolicy) IsActive() bool {
+	return p.Active || p.Url != ""
+}
+
+// ParseWebhookUrl returns the id and the token of a Discord webhook URL
+func ParseWebhookUrl(webhookUrl string) (string, string, bool) {
+	match := webhookUrlRegex.FindStringSubmatch(webhookUrl)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"LiveStatus/src/domain"
+	"sync/atomic"
+)
+
+// ConfigStore holds the effective configuration (yaml merged with the notifiers stored in database).
+// The returned config is shared and must be treated as read-only, updates replace it as a whole.
+type ConfigStore interface {
+	Get() *domain.Config
+	Set(config *domain.Config)
+}
+
+func NewConfigStore(config *domain.Config) ConfigStore {
+	store := &configStore{}
+	store.Set(config)
+	return store
+}
+
+type configStore struct {
+	config atomic.Pointer[domain.Config]
+}
+
+func (c *configStore) Get() *domain.Config {
+	return c.config.Load()
+}
+
+func (c *configStore) Set(config *domain.Config) {
+	c.config.Store(config)
+}
@@ -2,19 +2,48 @@ package internal
 
 import (
 	"LiveStatus/src/domain"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"go.etcd.io/bbolt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type Database interface {
 	Close() error
 	Open() error
+	Ping() error
 	SetMessageId(twitchId string, channelId string, messageId string) error
 	GetMessageId(twitchId string, channelId string) (string, error)
-	SetEventId(twitchId string, guildId string, messageId string) error
-	GetEventId(twitchId string, guildId string) (string, error)
+	SetThread(twitchId string, channelId string, thread domain.DiscordThread) error
+	GetThread(twitchId string, channelId string) (domain.DiscordThread, error)
+	GetThreads() ([]domain.DiscordThread, error)
+	SetCrosspostedStream(twitchId string, channelId string, startedAt time.Time) error
+	GetCrosspostedStream(twitchId string, channelId string) (time.Time, error)
+	SetBoardMessage(guildId string, message domain.DiscordBoardMessage) error
+	GetBoardMessage(guildId string) (domain.DiscordBoardMessage, error)
+	SetEvent(twitchId string, guildId string, event domain.DiscordEventRecord) error
+	GetEvent(twitchId string, guildId string) (domain.DiscordEventRecord, error)
+	GetAllEventIds() (map[string]bool, error)
+	SetMentionHistory(twitchId string, channelId string, history domain.MentionHistory) error
+	GetMentionHistory(twitchId string, channelId string) (domain.MentionHistory, error)
+	SetGuildNotifiers(guildId string, notifiers []domain.DiscordNotifier) error
+	GetAllGuildNotifiers() (map[string][]domain.DiscordNotifier, error)
+	SetStreamSessions(twitchId string, sessions []domain.StreamSession) error
+	GetStreamSessions(twitchId string) ([]domain.StreamSession, error)
+	AddNotificationRecord(guildId string, record domain.NotificationRecord) error
+	GetNotificationRecords(guildId string) ([]domain.NotificationRecord, error)
+	AddOutboxJobs(jobs []domain.OutboxJob) error
+	GetOutboxJobs() ([]domain.OutboxJob, error)
+	SetOutboxJob(job domain.OutboxJob) error
+	DeleteOutboxJob(id uint64) error
+	MoveOutboxJobToDead(job domain.OutboxJob) error
+	GetDeadOutboxJobs() ([]domain.OutboxJob, error)
+	RequeueDeadOutboxJob(id uint64) error
+	DeleteDeadOutboxJob(id uint64) error
 }
 
 func NewDatabase(path string) Database {
@@ -33,7 +62,7 @@ func (d *database) Close() error {
 }
 
 func (d *database) Open() error {
-	err := os.MkdirAll(filepath.Join(".", filepath.Dir(d.path)), os.ModePerm)
+	err := os.MkdirAll(filepath.Dir(d.path), os.ModePerm)
 	if err != nil {
 		return err
 	}
@@ -46,12 +75,61 @@ func (d *database) Open() error {
 	return nil
 }
 
-func (d *database) SetEventId(twitchId string, guildId string, messageId string) error {
-	return d.setValue(domain.DatabaseEventBucket, d.getDbKey(twitchId, guildId), messageId)
+// Ping fails when the database is not open
+func (d *database) Ping() error {
+	if d.db == nil {
+		return bbolt.ErrDatabaseNotOpen
+	}
+	return d.db.View(func(tx *bbolt.Tx) error { return nil })
 }
 
-func (d *database) GetEventId(twitchId string, guildId string) (string, error) {
-	return d.getValue(domain.DatabaseEventBucket, d.getDbKey(twitchId, guildId))
+// SetEvent stores the event of the streamer in the guild, an event without id removes it
+func (d *database) SetEvent(twitchId string, guildId string, event domain.DiscordEventRecord) error {
+	if event.Id == "" {
+		return d.deleteValue(domain.DatabaseEventBucket, d.getDbKey(twitchId, guildId))
+	}
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return d.setValue(domain.DatabaseEventBucket, d.getDbKey(twitchId, guildId), string(value))
+}
+
+// GetEvent returns the event of the streamer in the guild, an event stored as a bare id by a previous version is renewed on the next refresh
+func (d *database) GetEvent(twitchId string, guildId string) (domain.DiscordEventRecord, error) {
+	var event domain.DiscordEventRecord
+	value, err := d.getValue(domain.DatabaseEventBucket, d.getDbKey(twitchId, guildId))
+	if err != nil || value == "" {
+		return event, err
+	}
+	if !strings.HasPrefix(value, "{") {
+		return domain.DiscordEventRecord{Id: value}, nil
+	}
+	err = json.Unmarshal([]byte(value), &event)
+	return event, err
+}
+
+// GetAllEventIds returns the ids of the stored events of every streamer and guild
+func (d *database) GetAllEventIds() (map[string]bool, error) {
+	eventIds := make(map[string]bool)
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(domain.DatabaseEventBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			event := domain.DiscordEventRecord{Id: string(value)}
+			if strings.HasPrefix(string(value), "{") {
+				if err := json.Unmarshal(value, &event); err != nil {
+					return fmt.Errorf("invalid event %s: %w", key, err)
+				}
+			}
+			eventIds[event.Id] = true
+			return nil
+		})
+	})
+	return eventIds, err
 }
 
 func (d *database) SetMessageId(twitchId string, channelId string, messageId string) error {
@@ -62,6 +140,372 @@ func (d *database) GetMessageId(twitchId string, channelId string) (string, erro
 	return d.getValue(domain.DatabaseMessageBucket, d.getDbKey(twitchId, channelId))
 }
 
+// SetThread stores the thread of the streamer announcements in the channel, a thread without id removes it
+func (d *database) SetThread(twitchId string, channelId string, thread domain.DiscordThread) error {
+	if thread.Id == "" {
+		return d.deleteValue(domain.DatabaseThreadBucket, d.getDbKey(twitchId, channelId))
+	}
+
+	value, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+	return d.setValue(domain.DatabaseThreadBucket, d.getDbKey(twitchId, channelId), string(value))
+}
+
+func (d *database) GetThread(twitchId string, channelId string) (domain.DiscordThread, error) {
+	var thread domain.DiscordThread
+	value, err := d.getValue(domain.DatabaseThreadBucket, d.getDbKey(twitchId, channelId))
+	if err != nil || value == "" {
+		return thread, err
+	}
+	err = json.Unmarshal([]byte(value), &thread)
+	return thread, err
+}
+
+// GetThreads returns the stored threads of every streamer and channel
+func (d *database) GetThreads() ([]domain.DiscordThread, error) {
+	var threads []domain.DiscordThread
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(domain.DatabaseThreadBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var thread domain.DiscordThread
+			if err := json.Unmarshal(value, &thread); err != nil {
+				return fmt.Errorf("invalid thread %s: %w", key, err)
+			}
+			threads = append(threads, thread)
+			return nil
+		})
+	})
+	return threads, err
+}
+
+// SetCrosspostedStream stores the start of the last stream of the streamer crossposted from the channel
+func (d *database) SetCrosspostedStream(twitchId string, channelId string, startedAt time.Time) error {
+	return d.setValue(domain.DatabaseCrosspostBucket, d.getDbKey(twitchId, channelId), startedAt.Format(time.RFC3339))
+}
+
+func (d *database) GetCrosspostedStream(twitchId string, channelId string) (time.Time, error) {
+	value, err := d.getValue(domain.DatabaseCrosspostBucket, d.getDbKey(twitchId, channelId))
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (d *database) SetBoardMessage(guildId string, message domain.DiscordBoardMessage) error {
+	value, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return d.setValue(domain.DatabaseBoardBucket, guildId, string(value))
+}
+
+func (d *database) GetBoardMessage(guildId string) (domain.DiscordBoardMessage, error) {
+	var message domain.DiscordBoardMessage
+	value, err := d.getValue(domain.DatabaseBoardBucket, guildId)
+	if err != nil || value == "" {
+		return message, err
+	}
+	err = json.Unmarshal([]byte(value), &message)
+	return message, err
+}
+
+func (d *database) SetMentionHistory(twitchId string, channelId string, history domain.MentionHistory) error {
+	value, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return d.setValue(domain.DatabaseMentionBucket, d.getDbKey(twitchId, channelId), string(value))
+}
+
+func (d *database) GetMentionHistory(twitchId string, channelId string) (domain.MentionHistory, error) {
+	var history domain.MentionHistory
+	value, err := d.getValue(domain.DatabaseMentionBucket, d.getDbKey(twitchId, channelId))
+	if err != nil || value == "" {
+		return history, err
+	}
+	err = json.Unmarshal([]byte(value), &history)
+	return history, err
+}
+
+// SetGuildNotifiers stores the notifiers managed with Discord commands, an empty list removes the guild
+func (d *database) SetGuildNotifiers(guildId string, notifiers []domain.DiscordNotifier) error {
+	if len(notifiers) == 0 {
+		return d.deleteValue(domain.DatabaseNotifierBucket, guildId)
+	}
+
+	value, err := json.Marshal(notifiers)
+	if err != nil {
+		return err
+	}
+	return d.setValue(domain.DatabaseNotifierBucket, guildId, string(value))
+}
+
+func (d *database) GetAllGuildNotifiers() (map[string][]domain.DiscordNotifier, error) {
+	guildNotifiers := make(map[string][]domain.DiscordNotifier)
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(domain.DatabaseNotifierBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var notifiers []domain.DiscordNotifier
+			if err := json.Unmarshal(value, &notifiers); err != nil {
+				return fmt.Errorf("invalid notifiers of guild %s: %w", key, err)
+			}
+			guildNotifiers[string(key)] = notifiers
+			return nil
+		})
+	})
+	return guildNotifiers, err
+}
+
+// SetStreamSessions stores the sessions of the streamer, oldest first
+func (d *database) SetStreamSessions(twitchId string, sessions []domain.StreamSession) error {
+	value, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+	return d.setValue(domain.DatabaseSessionBucket, twitchId, string(value))
+}
+
+func (d *database) GetStreamSessions(twitchId string) ([]domain.StreamSession, error) {
+	var sessions []domain.StreamSession
+	value, err := d.getValue(domain.DatabaseSessionBucket, twitchId)
+	if err != nil || value == "" {
+		return sessions, err
+	}
+	err = json.Unmarshal([]byte(value), &sessions)
+	return sessions, err
+}
+
+// AddNotificationRecord appends the record to the history of the guild, only the domain.HistoryMaxNotifications most recent are kept
+func (d *database) AddNotificationRecord(guildId string, record domain.NotificationRecord) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(domain.DatabaseHistoryBucket))
+		if err != nil {
+			return err
+		}
+
+		var records []domain.NotificationRecord
+		if value := bucket.Get([]byte(guildId)); value != nil {
+			if err = json.Unmarshal(value, &records); err != nil {
+				return fmt.Errorf("invalid notification history of guild %s: %w", guildId, err)
+			}
+		}
+		records = append(records, record)
+		if len(records) > domain.HistoryMaxNotifications {
+			records = records[len(records)-domain.HistoryMaxNotifications:]
+		}
+
+		value, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(guildId), value)
+	})
+}
+
+// GetNotificationRecords returns the notification history of the guild, oldest first
+func (d *database) GetNotificationRecords(guildId string) ([]domain.NotificationRecord, error) {
+	var records []domain.NotificationRecord
+	value, err := d.getValue(domain.DatabaseHistoryBucket, guildId)
+	if err != nil || value == "" {
+		return records, err
+	}
+	err = json.Unmarshal([]byte(value), &records)
+	return records, err
+}
+
+// AddOutboxJobs queues the jobs in one transaction, a job is skipped when a pending job has the same key
+func (d *database) AddOutboxJobs(jobs []domain.OutboxJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(domain.DatabaseOutboxBucket))
+		if err != nil {
+			return err
+		}
+
+		pendingKeys := make(map[string]bool)
+		err = bucket.ForEach(func(key, value []byte) error {
+			var job domain.OutboxJob
+			if err := json.Unmarshal(value, &job); err != nil {
+				return fmt.Errorf("invalid outbox job %d: %w", binary.BigEndian.Uint64(key), err)
+			}
+			pendingKeys[job.Key] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if pendingKeys[job.Key] {
+				continue
+			}
+			pendingKeys[job.Key] = true
+
+			if job.Id, err = bucket.NextSequence(); err != nil {
+				return err
+			}
+			if err = d.putOutboxJob(bucket, job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetOutboxJobs returns the pending jobs, oldest first
+func (d *database) GetOutboxJobs() ([]domain.OutboxJob, error) {
+	return d.getOutboxJobs(domain.DatabaseOutboxBucket)
+}
+
+func (d *database) SetOutboxJob(job domain.OutboxJob) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(domain.DatabaseOutboxBucket))
+		if err != nil {
+			return err
+		}
+		return d.putOutboxJob(bucket, job)
+	})
+}
+
+func (d *database) DeleteOutboxJob(id uint64) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(domain.DatabaseOutboxBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete(getOutboxJobKey(id))
+	})
+}
+
+// MoveOutboxJobToDead removes the job from the outbox and keeps it as a dead letter, only the domain.OutboxMaxDeadLetters most recent are kept
+func (d *database) MoveOutboxJobToDead(job domain.OutboxJob) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket([]byte(domain.DatabaseOutboxBucket)); bucket != nil {
+			if err := bucket.Delete(getOutboxJobKey(job.Id)); err != nil {
+				return err
+			}
+		}
+
+		deadBucket, err := tx.CreateBucketIfNotExists([]byte(domain.DatabaseDeadBucket))
+		if err != nil {
+			return err
+		}
+		if err = d.putOutboxJob(deadBucket, job); err != nil {
+			return err
+		}
+
+		var deadIds [][]byte
+		_ = deadBucket.ForEach(func(key, _ []byte) error {
+			deadIds = append(deadIds, append([]byte(nil), key...))
+			return nil
+		})
+		for len(deadIds) > domain.OutboxMaxDeadLetters {
+			if err = deadBucket.Delete(deadIds[0]); err != nil {
+				return err
+			}
+			deadIds = deadIds[1:]
+		}
+		return nil
+	})
+}
+
+// GetDeadOutboxJobs returns the jobs given up, oldest first
+func (d *database) GetDeadOutboxJobs() ([]domain.OutboxJob, error) {
+	return d.getOutboxJobs(domain.DatabaseDeadBucket)
+}
+
+// RequeueDeadOutboxJob moves a dead letter back to the outbox with a new id, delivered after the pending jobs of its notifier
+func (d *database) RequeueDeadOutboxJob(id uint64) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		deadBucket := tx.Bucket([]byte(domain.DatabaseDeadBucket))
+		if deadBucket == nil || deadBucket.Get(getOutboxJobKey(id)) == nil {
+			return domain.ErrOutboxJobNotFound
+		}
+
+		var job domain.OutboxJob
+		if err := json.Unmarshal(deadBucket.Get(getOutboxJobKey(id)), &job); err != nil {
+			return fmt.Errorf("invalid dead outbox job %d: %w", id, err)
+		}
+		if err := deadBucket.Delete(getOutboxJobKey(id)); err != nil {
+			return err
+		}
+
+		bucket, err := tx.CreateBucketIfNotExists([]byte(domain.DatabaseOutboxBucket))
+		if err != nil {
+			return err
+		}
+		if job.Id, err = bucket.NextSequence(); err != nil {
+			return err
+		}
+		job.Attempts = 0
+		job.NextAttemptAt = time.Time{}
+		return d.putOutboxJob(bucket, job)
+	})
+}
+
+func (d *database) DeleteDeadOutboxJob(id uint64) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(domain.DatabaseDeadBucket))
+		if bucket == nil || bucket.Get(getOutboxJobKey(id)) == nil {
+			return domain.ErrOutboxJobNotFound
+		}
+		return bucket.Delete(getOutboxJobKey(id))
+	})
+}
+
+func (d *database) getOutboxJobs(bucketName string) ([]domain.OutboxJob, error) {
+	var jobs []domain.OutboxJob
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketName))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var job domain.OutboxJob
+			if err := json.Unmarshal(value, &job); err != nil {
+				return fmt.Errorf("invalid outbox job %d: %w", binary.BigEndian.Uint64(key), err)
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	return jobs, err
+}
+
+func (d *database) putOutboxJob(bucket *bbolt.Bucket, job domain.OutboxJob) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(getOutboxJobKey(job.Id), value)
+}
+
+// getOutboxJobKey returns the big-endian id, bbolt iterates the jobs in id order
+func getOutboxJobKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+func (d *database) deleteValue(bucketName string, key string) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketName))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
 func (d *database) setValue(bucketName string, key string, value string) error {
 	return d.db.Update(func(tx *bbolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketName))
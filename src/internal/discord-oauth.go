@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"LiveStatus/src/domain"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DiscordOAuth logs users in with the authorization code flow of Discord OAuth2
+type DiscordOAuth interface {
+	GetAuthorizeUrl(clientId string, redirectUrl string, state string) string
+	GetUser(clientId string, clientSecret string, redirectUrl string, code string) (*domain.DiscordOAuthUser, error)
+}
+
+// NewDiscordOAuth creates the OAuth2 client, httpClient can be nil to use http.DefaultClient
+func NewDiscordOAuth(httpClient *http.Client) DiscordOAuth {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &discordOAuth{
+		httpClient: httpClient,
+	}
+}
+
+type discordOAuth struct {
+	httpClient *http.Client
+}
+
+func (d *discordOAuth) GetAuthorizeUrl(clientId string, redirectUrl string, state string) string {
+	query := url.Values{}
+	query.Set("client_id", clientId)
+	query.Set("redirect_uri", redirectUrl)
+	query.Set("response_type", "code")
+	query.Set("scope", domain.DiscordOAuthScopes)
+	query.Set("state", state)
+	query.Set("prompt", "none")
+	return domain.DiscordOAuthAuthorizeUrl + "?" + query.Encode()
+}
+
+// GetUser exchanges the code for an access token then returns the user with its guilds, the token is not kept
+func (d *discordOAuth) GetUser(clientId string, clientSecret string, redirectUrl string, code string) (*domain.DiscordOAuthUser, error) {
+	form := url.Values{}
+	form.Set("client_id", clientId)
+	form.Set("client_secret", clientSecret)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectUrl)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	req, err := http.NewRequest(http.MethodPost, domain.DiscordOAuthTokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err = d.doJson(req, &token); err != nil {
+		return nil, fmt.Errorf("code exchange: %w", err)
+	}
+
+	var user domain.DiscordOAuthUser
+	if err = d.get(token.TokenType+" "+token.AccessToken, "/users/@me", &user); err != nil {
+		return nil, err
+	}
+	if err = d.get(token.TokenType+" "+token.AccessToken, "/users/@me/guilds", &user.Guilds); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (d *discordOAuth) get(authorization string, path string, result any) error {
+	req, err := http.NewRequest(http.MethodGet, domain.DiscordApiBaseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	if err = d.doJson(req, result); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (d *discordOAuth) doJson(req *http.Request, result any) error {
+	res, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("discord returned %s: %s", res.Status, body)
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"LiveStatus/src/domain"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// discordGlobalLimiter spaces the Discord requests to stay under the global rate limit of the bot.
+// discordgo only waits for the global limit after a 429, the per-route buckets are left to discordgo.
+type discordGlobalLimiter struct {
+	base     http.RoundTripper
+	interval time.Duration
+
+	mu     sync.Mutex
+	nextAt time.Time // Earliest start of the next request
+}
+
+// LimitDiscordHttpClient makes the client of a discordgo session wait for its turn under domain.DiscordGlobalRateLimit
+func LimitDiscordHttpClient(client *http.Client) {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &discordGlobalLimiter{
+		base:     base,
+		interval: time.Second / domain.DiscordGlobalRateLimit,
+	}
+}
+
+func (l *discordGlobalLimiter) RoundTrip(request *http.Request) (*http.Response, error) {
+	l.mu.Lock()
+	now := time.Now()
+	startAt := l.nextAt
+	if startAt.Before(now) {
+		startAt = now
+	}
+	l.nextAt = startAt.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait := startAt.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+	return l.base.RoundTrip(request)
+}
@@ -4,70 +4,97 @@ import (
 	"LiveStatus/src/domain"
 	"fmt"
 	"gopkg.in/yaml.v3"
-	"io"
-	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 )
 
 type I18n interface {
 	GetMessages(lang string) domain.I18nMessages
+	GetLangs() []string
 	Format(str string, streamVariables map[string]string) string
+	Reload() ([]string, error)
 }
 
 func NewI18n() (I18n, error) {
-	lang := &i18n{
-		messages: make(map[string]domain.I18nMessages),
-	}
-	if err := lang.initI18n(); err != nil {
+	lang := &i18n{}
+	messages, err := lang.loadAllMessages()
+	if err != nil {
 		return nil, err
 	}
+	lang.messages = messages
 
 	return lang, nil
 }
 
 type i18n struct {
+	mu       sync.RWMutex
 	messages map[string]domain.I18nMessages // lang as key
 }
 
-func (i *i18n) initI18n() error {
+// Reload reads the i18n directory again and swaps the messages, returns the langs added, changed or removed.
+// The running messages are kept if a file is invalid.
+func (i *i18n) Reload() ([]string, error) {
+	messages, err := i.loadAllMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var changedLangs []string
+	for lang, langMessages := range messages {
+		if oldMessages, ok := i.messages[lang]; !ok || !reflect.DeepEqual(oldMessages, langMessages) {
+			changedLangs = append(changedLangs, lang)
+		}
+	}
+	for lang := range i.messages {
+		if _, ok := messages[lang]; !ok {
+			changedLangs = append(changedLangs, lang)
+		}
+	}
+
+	i.messages = messages
+	return changedLangs, nil
+}
+
+func (i *i18n) loadAllMessages() (map[string]domain.I18nMessages, error) {
 	files, err := os.ReadDir(domain.I18nDirectory)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
+	messages := make(map[string]domain.I18nMessages)
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
 
-		if err := i.loadMessages(file.Name()); err != nil {
-			return err
+		langMessages, err := i.loadMessages(file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name(), err)
 		}
+		messages[strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))] = *langMessages
 	}
 
-	return nil
+	return messages, nil
 }
 
-func (i *i18n) loadMessages(fileName string) error {
-	file, err := os.Open(fmt.Sprintf("%s/%s", domain.I18nDirectory, fileName))
+func (i *i18n) loadMessages(fileName string) (*domain.I18nMessages, error) {
+	all, err := os.ReadFile(filepath.Join(domain.I18nDirectory, fileName))
 	if err != nil {
-		return err
-	}
-
-	all, err := io.ReadAll(file)
-	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var i18nMessages domain.I18nMessages
 	if err := yaml.Unmarshal(all, &i18nMessages); err != nil {
-		return err
+		return nil, err
 	}
-
-	i.messages[strings.TrimSuffix(fileName, filepath.Ext(fileName))] = i18nMessages
-	return nil
+	return &i18nMessages, nil
 }
 
 func (i *i18n) Format(str string, variables map[string]string) string {
@@ -78,6 +105,9 @@ func (i *i18n) Format(str string, variables map[string]string) string {
 }
 
 func (i *i18n) GetMessages(lang string) domain.I18nMessages {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	if message, ok := i.messages[lang]; ok {
 		return message
 	}
@@ -86,3 +116,15 @@ func (i *i18n) GetMessages(lang string) domain.I18nMessages {
 	}
 	return domain.I18nMessages{}
 }
+
+func (i *i18n) GetLangs() []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	langs := make([]string, 0, len(i.messages))
+	for lang := range i.messages {
+		langs = append(langs, lang)
+	}
+	slices.Sort(langs)
+	return langs
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"LiveStatus/src/domain"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ImageService interface {
+	domain.ImageResolver
+}
+
+// NewImageService creates a cached domain.ImageResolver, httpClient can be nil to use http.DefaultClient
+func NewImageService(twClient TwitchClient, httpClient *http.Client) ImageService {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &imageService{
+		twClient:     twClient,
+		httpClient:   httpClient,
+		gameImages:   make(map[string]gameImageEntry),
+		streamImages: make(map[string]streamImageEntry),
+	}
+}
+
+type imageService struct {
+	twClient     TwitchClient
+	httpClient   *http.Client
+	mu           sync.Mutex
+	gameImages   map[string]gameImageEntry   // gameId as key
+	streamImages map[string]streamImageEntry // thumbnail url as key
+}
+
+type gameImageEntry struct {
+	url       string
+	expiresAt time.Time
+}
+
+type streamImageEntry struct {
+	dataUrl      string
+	etag         string
+	lastModified string
+	expiresAt    time.Time
+}
+
+// GetGameImageUrl resolves the box art through Helix /games and caches it for domain.GameImageCacheTtl
+func (s *imageService) GetGameImageUrl(gameId string) (string, error) {
+	if gameId == "" {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	entry, ok := s.gameImages[gameId]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.url, nil
+	}
+
+	games, err := s.twClient.GetGames([]string{gameId})
+	if err != nil {
+		if ok {
+			return entry.url, nil // Keep serving the stale box art rather than failing the whole update
+		}
+		return "", err
+	}
+
+	imageUrl := ""
+	if game, gameOk := games[gameId]; gameOk {
+		imageUrl = domain.FormatTwitchImageUrl(game.BoxArtUrl, domain.GameThumbnailWidth, domain.GameThumbnailHeight)
+	}
+
+	s.mu.Lock()
+	s.gameImages[gameId] = gameImageEntry{
+		url:       imageUrl,
+		expiresAt: time.Now().Add(domain.GameImageCacheTtl),
+	}
+	s.mu.Unlock()
+
+	return imageUrl, nil
+}
+
+// GetStreamImage downloads the thumbnail at the scheduled event size and caches it for domain.StreamImageCacheTtl.
+// Once expired, the thumbnail is revalidated with ETag/If-Modified-Since to avoid downloading an unchanged image.
+func (s *imageService) GetStreamImage(thumbnailUrl string) (string, error) {
+	if thumbnailUrl == "" {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	cached, ok := s.streamImages[thumbnailUrl]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.dataUrl, nil
+	}
+
+	entry, err := s.downloadStreamImage(thumbnailUrl, cached, ok)
+	if err != nil {
+		if ok {
+			return cached.dataUrl, nil // Keep serving the stale thumbnail rather than failing the whole update
+		}
+		return "", err
+	}
+
+	entry.expiresAt = time.Now().Add(domain.StreamImageCacheTtl)
+	s.mu.Lock()
+	s.streamImages[thumbnailUrl] = entry
+	s.mu.Unlock()
+
+	return entry.dataUrl, nil
+}
+
+// downloadStreamImage downloads the thumbnail, or revalidates the cached one when isCached
+func (s *imageService) downloadStreamImage(thumbnailUrl string, cached streamImageEntry, isCached bool) (streamImageEntry, error) {
+	req, err := http.NewRequest("GET", domain.FormatTwitchImageUrl(thumbnailUrl, domain.StreamEventImageWidth, domain.StreamEventImageHeight), nil)
+	if err != nil {
+		return streamImageEntry{}, err
+	}
+	if isCached {
+		if cached.etag != "" {
+			req.Header.Set(domain.IfNoneMatchHeader, cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set(domain.IfModifiedSinceHeader, cached.lastModified)
+		}
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return streamImageEntry{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && isCached:
+		return cached, nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return streamImageEntry{}, err
+		}
+		return streamImageEntry{
+			dataUrl:      fmt.Sprintf("data:image/jpeg;base64,%s", base64.StdEncoding.EncodeToString(body)),
+			etag:         resp.Header.Get(domain.ETagHeader),
+			lastModified: resp.Header.Get(domain.LastModifiedHeader),
+		}, nil
+	default:
+		return streamImageEntry{}, fmt.Errorf("stream image request failed with status code %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedLogTimeLayout = "20060102T150405.000"
+
+// RotatingFile is an append-only file renamed with its rotation date when it exceeds maxSize or maxAge,
+// only the maxBackups most recent rotated files are kept
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64         // 0 to disable
+	maxAge     time.Duration // 0 to disable
+	maxBackups int           // 0 to keep every rotated file
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+}
+
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	r := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exceedsSize := r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize
+	exceedsAge := r.maxAge > 0 && time.Since(r.openedAt) > r.maxAge
+	if exceedsSize || exceedsAge {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	if r.size > 0 {
+		r.openedAt = info.ModTime() // Best effort, the creation date is not portable
+	}
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	extension := filepath.Ext(r.path)
+	rotatedPath := strings.TrimSuffix(r.path, extension) + "-" + time.Now().Format(rotatedLogTimeLayout) + extension
+	if err := os.Rename(r.path, rotatedPath); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.removeOldBackups()
+	return nil
+}
+
+func (r *RotatingFile) removeOldBackups() {
+	if r.maxBackups <= 0 {
+		return
+	}
+
+	extension := filepath.Ext(r.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(r.path, extension) + "-*" + extension)
+	if err != nil || len(backups) <= r.maxBackups {
+		return
+	}
+	slices.Sort(backups) // The date layout sorts chronologically
+	for _, backup := range backups[:len(backups)-r.maxBackups] {
+		_ = os.Remove(backup)
+	}
+}
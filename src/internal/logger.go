@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"LiveStatus/src/domain"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	logHandler atomic.Pointer[slog.Handler] // Shared by the components, replaced by InitLogger
+
+	logLevelsMu sync.Mutex
+	logLevels   = make(map[string]*slog.LevelVar) // Key is the component
+)
+
+// Loggers of the components, see domain.LogComponents
+var (
+	TwitchLog  = NewLogger(domain.LogComponentTwitch)
+	DiscordLog = NewLogger(domain.LogComponentDiscord)
+	CronLog    = NewLogger(domain.LogComponentCron)
+	ConfigLog  = NewLogger(domain.LogComponentConfig)
+	HttpLog    = NewLogger(domain.LogComponentHttp)
+)
+
+func init() {
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logHandler.Store(&handler)
+}
+
+// NewLogger returns the logger of a component (see domain.LogComponents), it can be created before InitLogger
+func NewLogger(component string) *slog.Logger {
+	return slog.New(&componentHandler{
+		component: component,
+		level:     getLogLevel(component),
+		with:      func(handler slog.Handler) slog.Handler { return handler },
+	})
+}
+
+// InitLogger writes the logs to stdout and to the rotated log file, the std log package is redirected to slog
+func InitLogger(config domain.LogConfig, fileName string) (io.Closer, error) {
+	file, err := NewRotatingFile(fileName, int64(config.MaxSize)*1024*1024, config.MaxAge, config.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := io.MultiWriter(os.Stdout, file)
+	options := &slog.HandlerOptions{Level: slog.LevelDebug} // Filtered by the component levels
+	var handler slog.Handler = slog.NewTextHandler(writer, options)
+	if config.Format == domain.LogFormatJson {
+		handler = slog.NewJSONHandler(writer, options)
+	}
+	logHandler.Store(&handler)
+	SetLogLevels(config)
+
+	slog.SetDefault(slog.New(handler))
+	return file, nil
+}
+
+// SetLogLevels applies the levels of the config to every component, invalid levels are ignored (see domain.Config Validate)
+func SetLogLevels(config domain.LogConfig) {
+	var defaultLevel slog.Level
+	_ = defaultLevel.UnmarshalText([]byte(config.Level))
+
+	logLevelsMu.Lock()
+	components := make([]string, 0, len(logLevels))
+	for component := range logLevels {
+		components = append(components, component)
+	}
+	logLevelsMu.Unlock()
+
+	for _, component := range append(components, domain.LogComponents...) {
+		level := defaultLevel
+		if componentLevel, ok := config.Levels[component]; ok {
+			_ = level.UnmarshalText([]byte(componentLevel))
+		}
+		getLogLevel(component).Set(level)
+	}
+}
+
+func getLogLevel(component string) *slog.LevelVar {
+	logLevelsMu.Lock()
+	defer logLevelsMu.Unlock()
+	level, ok := logLevels[component]
+	if !ok {
+		level = &slog.LevelVar{}
+		logLevels[component] = level
+	}
+	return level
+}
+
+// componentHandler filters the records with the level of its component then forwards them to the shared handler
+type componentHandler struct {
+	component string
+	level     *slog.LevelVar
+	with      func(handler slog.Handler) slog.Handler // Attributes and groups added with WithAttrs and WithGroup
+}
+
+func (h *componentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := (*logHandler.Load()).WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	return h.with(handler).Handle(ctx, record)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{
+		component: h.component,
+		level:     h.level,
+		with:      func(handler slog.Handler) slog.Handler { return h.with(handler).WithAttrs(attrs) },
+	}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{
+		component: h.component,
+		level:     h.level,
+		with:      func(handler slog.Handler) slog.Handler { return h.with(handler).WithGroup(name) },
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	requestDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	discordApiVersionRegex = regexp.MustCompile(`^/api/v\d+`)
+	discordTokenRegex      = regexp.MustCompile(`^[\w-]{40,}$`) // Interaction and webhook tokens
+)
+
+// Metrics are the application metrics exposed on /metrics in the Prometheus text format
+type Metrics struct {
+	registry *prometheus.Registry
+
+	EventSubNotifications     CounterVec               // type
+	LiveStateUpdateRetries    CounterVec               // type
+	LiveStateUpdateFailures   CounterVec               // type
+	DiscordMessages           CounterVec               // action
+	DiscordEvents             CounterVec               // action
+	OutboxJobs                CounterVec               // result
+	helixRequestDuration      *prometheus.HistogramVec // path, status
+	discordRequestDuration    *prometheus.HistogramVec // method, route, status
+	eventSubSubscriptionCosts *prometheus.GaugeVec     // kind (total, max)
+}
+
+const (
+	MetricsActionCreated     = "created"
+	MetricsActionEdited      = "edited"
+	MetricsActionDeleted     = "deleted"
+	MetricsActionCrossposted = "crossposted"
+
+	MetricsOutboxDelivered = "delivered"
+	MetricsOutboxRetried   = "retried"
+	MetricsOutboxDead      = "dead"
+
+	metricsStatusError = "error" // The request failed without response
+)
+
+// CounterVec is a counter with a single label, its value is the only argument so a call site can't mismatch the labels
+type CounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+func (c CounterVec) Inc(labelValue string) {
+	if counter, err := c.vec.GetMetricWithLabelValues(labelValue); err == nil { // Invalid UTF-8 values are dropped
+		counter.Inc()
+	}
+}
+
+// NewMetrics registers the metrics, a name or label problem panics here rather than when a metric is updated
+func NewMetrics() *Metrics {
+	registry := prometheus.NewRegistry()
+	newCounterVec := func(name string, help string, label string) CounterVec {
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, []string{label})
+		registry.MustRegister(vec)
+		return CounterVec{vec: vec}
+	}
+	newHistogramVec := func(name string, help string, labels ...string) *prometheus.HistogramVec {
+		vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: requestDurationBuckets}, labels)
+		registry.MustRegister(vec)
+		return vec
+	}
+	eventSubSubscriptionCosts := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "livestatus_eventsub_subscription_cost",
+		Help: "EventSub subscriptions total cost and max total cost returned by the last subscription",
+	}, []string{"kind"})
+	registry.MustRegister(eventSubSubscriptionCosts)
+
+	return &Metrics{
+		registry: registry,
+		EventSubNotifications: newCounterVec("livestatus_eventsub_notifications_total",
+			"EventSub notifications received by subscription type", "type"),
+		LiveStateUpdateRetries: newCounterVec("livestatus_live_state_update_retries_total",
+			"Failed attempts of updateLiveState that were retried", "type"),
+		LiveStateUpdateFailures: newCounterVec("livestatus_live_state_update_failures_total",
+			"updateLiveState giving up after every retry", "type"),
+		DiscordMessages: newCounterVec("livestatus_discord_messages_total",
+			"Discord live messages created, edited, deleted and crossposted", "action"),
+		DiscordEvents: newCounterVec("livestatus_discord_events_total",
+			"Discord scheduled events created, edited and deleted", "action"),
+		OutboxJobs: newCounterVec("livestatus_outbox_jobs_total",
+			"Outbox jobs delivered, retried after a failure and given up as dead letters", "result"),
+		helixRequestDuration: newHistogramVec("livestatus_helix_request_duration_seconds",
+			"Duration of the Twitch Helix and OAuth requests by path and status code", "path", "status"),
+		discordRequestDuration: newHistogramVec("livestatus_discord_request_duration_seconds",
+			"Duration of the Discord API calls by route and status code", "method", "route", "status"),
+		eventSubSubscriptionCosts: eventSubSubscriptionCosts,
+	}
+}
+
+func (m *Metrics) GetHandler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// AddGaugeFunc registers a gauge computed when the metrics are collected
+func (m *Metrics) AddGaugeFunc(name string, help string, value func() float64) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value))
+}
+
+func (m *Metrics) SetSubscriptionCost(totalCost int, maxTotalCost int) {
+	m.eventSubSubscriptionCosts.WithLabelValues("total").Set(float64(totalCost))
+	m.eventSubSubscriptionCosts.WithLabelValues("max").Set(float64(maxTotalCost))
+}
+
+// observeDuration drops the observation when a label value is rejected (invalid UTF-8 in a path), a metric must not
+// fail a request
+func observeDuration(vec *prometheus.HistogramVec, duration time.Duration, labelValues ...string) {
+	if observer, err := vec.GetMetricWithLabelValues(labelValues...); err == nil {
+		observer.Observe(duration.Seconds())
+	}
+}
+
+// NewHelixHttpClient returns an HTTP client observing HelixRequestDuration
+func (m *Metrics) NewHelixHttpClient() *http.Client {
+	return &http.Client{Transport: &metricsTransport{
+		base: http.DefaultTransport,
+		observe: func(request *http.Request, status string, duration time.Duration) {
+			observeDuration(m.helixRequestDuration, duration, request.URL.Path, status)
+		},
+	}}
+}
+
+// InstrumentDiscordHttpClient makes the client of a discordgo session observe DiscordRequestDuration
+func (m *Metrics) InstrumentDiscordHttpClient(client *http.Client) {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &metricsTransport{
+		base: base,
+		observe: func(request *http.Request, status string, duration time.Duration) {
+			observeDuration(m.discordRequestDuration, duration, request.Method, getDiscordRoute(request.URL), status)
+		},
+	}
+}
+
+type metricsTransport struct {
+	base    http.RoundTripper
+	observe func(request *http.Request, status string, duration time.Duration)
+}
+
+func (t *metricsTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := t.base.RoundTrip(request)
+	status := metricsStatusError
+	if err == nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	t.observe(request, status, time.Since(start))
+	return response, err
+}
+
+// getDiscordRoute replaces the ids and tokens of the path to keep a bounded number of routes, e.g. /channels/:id/messages/:id
+func getDiscordRoute(requestUrl *url.URL) string {
+	segments := strings.Split(discordApiVersionRegex.ReplaceAllString(requestUrl.Path, ""), "/")
+	for index, segment := range segments {
+		if _, err := strconv.ParseUint(segment, 10, 64); err == nil {
+			segments[index] = ":id"
+		} else if discordTokenRegex.MatchString(segment) {
+			segments[index] = ":token"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -3,12 +3,14 @@ package internal
 import (
 	"LiveStatus/src/domain"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/avast/retry-go/v4"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -17,15 +19,36 @@ type TwitchClient interface {
 	Init() error
 	GetSubscriber() domain.TwitchSubscriber
 	GetTwitchUsers(userIds []string) (map[string]domain.TwitchUserResponse, error)
+	GetTwitchUsersByLogin(logins []string) (map[string]domain.TwitchUserResponse, error)
 	GetStreams(userIds []string) (map[string]domain.TwitchStreamResponse, error)
+	GetGames(gameIds []string) (map[string]domain.TwitchGameResponse, error)
+	HasValidToken() bool
 }
 
-func NewTwitchClient(clientId string, clientSecret string, webhookUrl string, webhookSecret string, factory domain.SubscriberFactory) TwitchClient {
+// NewTwitchClient creates a Helix client, httpClient can be nil to use http.DefaultClient
+func NewTwitchClient(config domain.TwitchConfig, httpClient *http.Client, factory domain.SubscriberFactory) TwitchClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	helixUrl := config.HelixUrl
+	if helixUrl == "" {
+		helixUrl = domain.TwitchHelixBaseUrl
+	}
+	authUrl := config.AuthUrl
+	if authUrl == "" {
+		authUrl = domain.TwitchAuthBaseUrl
+	}
+
 	return &twitchClient{
-		clientId:      clientId,
-		clientSecret:  clientSecret,
-		webhookUrl:    webhookUrl,
-		webhookSecret: webhookSecret,
+		clientId:      config.ClientId,
+		clientSecret:  config.ClientSecret,
+		webhookUrl:    config.WebhookUrl,
+		webhookSecret: config.WebhookSecret,
+		helixUrl:      strings.TrimSuffix(helixUrl, "/"),
+		authUrl:       strings.TrimSuffix(authUrl, "/"),
+		httpClient:    httpClient,
+		rateLimiter:   newRateLimiter(),
 		factory:       factory,
 	}
 }
@@ -35,7 +58,12 @@ type twitchClient struct {
 	clientSecret  string
 	webhookUrl    string
 	webhookSecret string
+	helixUrl      string
+	authUrl       string
+	httpClient    *http.Client
+	rateLimiter   *rateLimiter
 	factory       domain.SubscriberFactory
+	tokenMu       sync.Mutex
 	appToken      atomic.Pointer[string]
 	expiresAt     atomic.Int64 // unix seconds
 	subscriber    domain.TwitchSubscriber
@@ -53,11 +81,12 @@ func (t *twitchClient) GetSubscriber() domain.TwitchSubscriber {
 	return t.subscriber
 }
 
-func (t *twitchClient) generateTwitchAppToken() error {
+// generateTwitchAppToken requests a new app token, opts override the retry options of the request
+func (t *twitchClient) generateTwitchAppToken(opts ...retry.Option) error {
 	clientId := t.clientId
 	clientSecret := t.clientSecret
 
-	result, err := createTwitchRequest("POST", domain.GetTwitchAppTokenUrl, map[string]string{},
+	result, err := createTwitchRequest(t, "POST", t.authUrl+domain.TwitchTokenPath, false,
 		func() io.Reader {
 			form := url.Values{}
 			form.Add("client_id", clientId)
@@ -91,7 +120,7 @@ func (t *twitchClient) generateTwitchAppToken() error {
 				token:     token,
 				expiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second).Unix(),
 			}, nil
-		})
+		}, opts...)
 	if err != nil {
 		return err
 	}
@@ -101,76 +130,129 @@ func (t *twitchClient) generateTwitchAppToken() error {
 	return nil
 }
 
+// ensureValidToken generates the app token when it is missing or about to expire. A single attempt is made while
+// tokenMu is held, the request needing the token retries it with its own backoff so the other callers are not blocked
 func (t *twitchClient) ensureValidToken() error {
+	t.tokenMu.Lock()
+	defer t.tokenMu.Unlock()
+
 	expiresAt := time.Unix(t.expiresAt.Load(), 0)
 	if t.appToken.Load() == nil || time.Now().Add(30*time.Second).After(expiresAt) {
-		return t.generateTwitchAppToken()
+		return t.generateTwitchAppToken(retry.Attempts(1))
 	}
 	return nil
 }
 
+// HasValidToken reports whether the app token is generated and not expired, it doesn't call Twitch
+func (t *twitchClient) HasValidToken() bool {
+	return t.appToken.Load() != nil && time.Now().Before(time.Unix(t.expiresAt.Load(), 0))
+}
+
+// invalidateToken forces the next request to generate a new app token
+func (t *twitchClient) invalidateToken() {
+	t.expiresAt.Store(0)
+}
+
+// GetTwitchUsers returns the users by id, twitchId as key
 func (t *twitchClient) GetTwitchUsers(userIds []string) (map[string]domain.TwitchUserResponse, error) {
-	if len(userIds) == 0 {
-		return make(map[string]domain.TwitchUserResponse), nil
-	}
+	return t.getTwitchUsers("id", userIds)
+}
 
-	if err := t.ensureValidToken(); err != nil {
-		return nil, err
-	}
+// GetTwitchUsersByLogin returns the users by login, twitchId as key
+func (t *twitchClient) GetTwitchUsersByLogin(logins []string) (map[string]domain.TwitchUserResponse, error) {
+	return t.getTwitchUsers("login", logins)
+}
 
-	appToken := *t.appToken.Load()
-	mapIdToUser, err := createTwitchRequest("GET", fmt.Sprintf("%s?%s", domain.GetTwitchUsersUrl, url.Values{"id": userIds}.Encode()), map[string]string{
-		domain.TwitchClientIdHeader:      t.clientId,
-		domain.TwitchAuthorizationHeader: "Bearer " + appToken,
-	}, nil,
-		func(res *http.Response) (*map[string]domain.TwitchUserResponse, error) {
-			var data domain.TwitchUsersResponse
-			if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
-				return nil, err
-			}
+func (t *twitchClient) getTwitchUsers(queryParam string, values []string) (map[string]domain.TwitchUserResponse, error) {
+	mapIdToUser := make(map[string]domain.TwitchUserResponse)
 
-			mapIdToUser := make(map[string]domain.TwitchUserResponse)
-			for _, user := range data.Data {
-				mapIdToUser[user.ID] = user
-			}
-			return &mapIdToUser, nil
-		})
-	if err != nil {
-		return nil, err
+	for _, chunk := range chunkIds(values, domain.TwitchMaxIdsPerRequest) {
+		data, err := createTwitchRequest(t, "GET", t.getHelixUrl(domain.TwitchUsersPath, url.Values{queryParam: chunk}), true, nil,
+			func(res *http.Response) (*domain.TwitchUsersResponse, error) {
+				var data domain.TwitchUsersResponse
+				if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+					return nil, err
+				}
+				return &data, nil
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, user := range data.Data {
+			mapIdToUser[user.ID] = user
+		}
 	}
-	return *mapIdToUser, nil
+
+	return mapIdToUser, nil
 }
 
 func (t *twitchClient) GetStreams(userIds []string) (map[string]domain.TwitchStreamResponse, error) {
-	if len(userIds) == 0 {
-		return make(map[string]domain.TwitchStreamResponse), nil
-	}
+	mapIdToStream := make(map[string]domain.TwitchStreamResponse)
 
-	if err := t.ensureValidToken(); err != nil {
-		return nil, err
-	}
+	for _, chunk := range chunkIds(userIds, domain.TwitchMaxIdsPerRequest) {
+		cursor := ""
+		for {
+			query := url.Values{
+				"user_id": chunk,
+				"first":   {fmt.Sprintf("%d", domain.TwitchMaxIdsPerRequest)},
+			}
+			if cursor != "" {
+				query.Set("after", cursor)
+			}
 
-	appToken := *t.appToken.Load()
-	mapIdToStream, err := createTwitchRequest("GET", fmt.Sprintf("%s?%s", domain.GetTwitchStreamsUrl, url.Values{"user_id": userIds}.Encode()), map[string]string{
-		domain.TwitchClientIdHeader:      t.clientId,
-		domain.TwitchAuthorizationHeader: "Bearer " + appToken,
-	}, nil,
-		func(res *http.Response) (*map[string]domain.TwitchStreamResponse, error) {
-			var data domain.TwitchStreamsResponse
-			if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+			data, err := createTwitchRequest(t, "GET", t.getHelixUrl(domain.TwitchStreamsPath, query), true, nil,
+				func(res *http.Response) (*domain.TwitchStreamsResponse, error) {
+					var data domain.TwitchStreamsResponse
+					if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+						return nil, err
+					}
+					return &data, nil
+				})
+			if err != nil {
 				return nil, err
 			}
 
-			mapIdToStream := make(map[string]domain.TwitchStreamResponse)
 			for _, stream := range data.Data {
 				mapIdToStream[stream.UserID] = stream
 			}
-			return &mapIdToStream, nil
-		})
-	if err != nil {
-		return nil, err
+
+			if data.Pagination.Cursor == "" || data.Pagination.Cursor == cursor || len(data.Data) == 0 {
+				break
+			}
+			cursor = data.Pagination.Cursor
+		}
 	}
-	return *mapIdToStream, nil
+
+	return mapIdToStream, nil
+}
+
+func (t *twitchClient) GetGames(gameIds []string) (map[string]domain.TwitchGameResponse, error) {
+	mapIdToGame := make(map[string]domain.TwitchGameResponse)
+
+	for _, chunk := range chunkIds(gameIds, domain.TwitchMaxIdsPerRequest) {
+		data, err := createTwitchRequest(t, "GET", t.getHelixUrl(domain.TwitchGamesPath, url.Values{"id": chunk}), true, nil,
+			func(res *http.Response) (*domain.TwitchGamesResponse, error) {
+				var data domain.TwitchGamesResponse
+				if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+					return nil, err
+				}
+				return &data, nil
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, game := range data.Data {
+			mapIdToGame[game.ID] = game
+		}
+	}
+
+	return mapIdToGame, nil
+}
+
+func (t *twitchClient) getHelixUrl(path string, query url.Values) string {
+	return fmt.Sprintf("%s%s?%s", t.helixUrl, path, query.Encode())
 }
 
 type tokenResult struct {
@@ -178,7 +260,25 @@ type tokenResult struct {
 	expiresAt int64
 }
 
-func createTwitchRequest[T any](method string, rawURL string, headers map[string]string, bodyFactory func() io.Reader, extractBody func(*http.Response) (*T, error)) (*T, error) {
+type twitchStatusError struct {
+	statusCode int
+}
+
+func (e *twitchStatusError) Error() string {
+	return fmt.Sprintf("twitch request failed with status code %d", e.statusCode)
+}
+
+// twitchRetryDelay retries immediately after a token refresh or a rate limit (the rateLimiter already waits), and backs off otherwise
+func twitchRetryDelay(n uint, err error, config *retry.Config) time.Duration {
+	var statusErr *twitchStatusError
+	if errors.As(err, &statusErr) && (statusErr.statusCode == http.StatusUnauthorized || statusErr.statusCode == http.StatusTooManyRequests) {
+		return 0
+	}
+	return retry.BackOffDelay(n, err, config)
+}
+
+func createTwitchRequest[T any](t *twitchClient, method string, rawURL string, authenticated bool, bodyFactory func() io.Reader, extractBody func(*http.Response) (*T, error), opts ...retry.Option) (*T, error) {
+	options := []retry.Option{retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay), retry.DelayType(twitchRetryDelay), retry.LastErrorOnly(true)}
 	return retry.DoWithData(func() (*T, error) {
 		var body io.Reader
 		if bodyFactory != nil {
@@ -187,14 +287,23 @@ func createTwitchRequest[T any](method string, rawURL string, headers map[string
 
 		req, err := http.NewRequest(method, rawURL, body)
 		if err != nil {
-			return nil, err
+			return nil, retry.Unrecoverable(err)
+		}
+
+		if method == "POST" && body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		}
 
-		for key, value := range headers {
-			req.Header.Add(key, value)
+		if authenticated {
+			if err := t.ensureValidToken(); err != nil {
+				return nil, err
+			}
+			req.Header.Set(domain.TwitchClientIdHeader, t.clientId)
+			req.Header.Set(domain.TwitchAuthorizationHeader, "Bearer "+*t.appToken.Load())
+			t.rateLimiter.take()
 		}
 
-		res, err := http.DefaultClient.Do(req)
+		res, err := t.httpClient.Do(req)
 		if err != nil {
 			return nil, err
 		}
@@ -202,14 +311,34 @@ func createTwitchRequest[T any](method string, rawURL string, headers map[string
 			_ = res.Body.Close()
 		}()
 
-		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("twitch request failed with status code %d", res.StatusCode)
+		if authenticated {
+			t.rateLimiter.update(res.Header)
 		}
 
-		data, err := extractBody(res)
-		if err != nil {
-			return nil, err
+		switch {
+		case res.StatusCode == http.StatusOK:
+			return extractBody(res)
+		case res.StatusCode == http.StatusUnauthorized && authenticated:
+			t.invalidateToken()
+			return nil, &twitchStatusError{statusCode: res.StatusCode}
+		case res.StatusCode == http.StatusTooManyRequests:
+			t.rateLimiter.exhaust(res.Header)
+			return nil, &twitchStatusError{statusCode: res.StatusCode}
+		case res.StatusCode >= http.StatusInternalServerError:
+			return nil, &twitchStatusError{statusCode: res.StatusCode}
+		default:
+			return nil, retry.Unrecoverable(&twitchStatusError{statusCode: res.StatusCode})
 		}
-		return data, nil
-	}, retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay))
+	}, append(options, opts...)...)
+}
+
+func chunkIds(ids []string, size int) [][]string {
+	var chunks [][]string
+	for size < len(ids) {
+		ids, chunks = ids[size:], append(chunks, ids[:size])
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
 }
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"LiveStatus/src/domain"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestTwitchClient serves the token endpoint and the Helix handlers of the test, it returns the number of tokens generated
+func newTestTwitchClient(t *testing.T, helix map[string]http.HandlerFunc) (*twitchClient, func() int) {
+	var mu sync.Mutex
+	tokens := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc(domain.TwitchTokenPath, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens++
+		token := fmt.Sprintf("token-%d", tokens)
+		mu.Unlock()
+		writeTestJson(t, w, map[string]any{"access_token": token, "expires_in": 3600})
+	})
+	for path, handler := range helix {
+		mux.HandleFunc(path, handler)
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	config := domain.TwitchConfig{ClientId: "client", ClientSecret: "secret", HelixUrl: server.URL, AuthUrl: server.URL}
+	client := NewTwitchClient(config, server.Client(), nil).(*twitchClient)
+	return client, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return tokens
+	}
+}
+
+func writeTestJson(t *testing.T, w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		t.Errorf("failed to write the response: %v", err)
+	}
+}
+
+func TestGetStreamsSplitsIds(t *testing.T) {
+	var mu sync.Mutex
+	var requestSizes []int
+	client, _ := newTestTwitchClient(t, map[string]http.HandlerFunc{
+		domain.TwitchStreamsPath: func(w http.ResponseWriter, r *http.Request) {
+			userIds := r.URL.Query()["user_id"]
+			mu.Lock()
+			requestSizes = append(requestSizes, len(userIds))
+			mu.Unlock()
+
+			var streams []domain.TwitchStreamResponse
+			for _, userId := range userIds {
+				streams = append(streams, domain.TwitchStreamResponse{UserID: userId, Type: "live"})
+			}
+			writeTestJson(t, w, domain.TwitchStreamsResponse{Data: streams})
+		},
+	})
+
+	userIds := make([]string, 150)
+	for i := range userIds {
+		userIds[i] = strconv.Itoa(i + 1)
+	}
+	streams, err := client.GetStreams(userIds)
+	if err != nil {
+		t.Fatalf("GetStreams failed: %v", err)
+	}
+
+	if len(requestSizes) != 2 || requestSizes[0] != 100 || requestSizes[1] != 50 {
+		t.Errorf("expected requests of 100 and 50 ids, got %v", requestSizes)
+	}
+	if len(streams) != 150 {
+		t.Errorf("expected 150 streams, got %d", len(streams))
+	}
+}
+
+func TestGetStreamsFollowsCursor(t *testing.T) {
+	var afters []string
+	client, _ := newTestTwitchClient(t, map[string]http.HandlerFunc{
+		domain.TwitchStreamsPath: func(w http.ResponseWriter, r *http.Request) {
+			after := r.URL.Query().Get("after")
+			afters = append(afters, after)
+
+			switch after {
+			case "":
+				writeTestJson(t, w, domain.TwitchStreamsResponse{
+					Data:       []domain.TwitchStreamResponse{{UserID: "1", Type: "live"}},
+					Pagination: domain.TwitchPagination{Cursor: "page-2"},
+				})
+			case "page-2":
+				writeTestJson(t, w, domain.TwitchStreamsResponse{Data: []domain.TwitchStreamResponse{{UserID: "2", Type: "live"}}})
+			default:
+				t.Errorf("unexpected cursor %q", after)
+				writeTestJson(t, w, domain.TwitchStreamsResponse{})
+			}
+		},
+	})
+
+	streams, err := client.GetStreams([]string{"1", "2"})
+	if err != nil {
+		t.Fatalf("GetStreams failed: %v", err)
+	}
+
+	if len(afters) != 2 || afters[1] != "page-2" {
+		t.Errorf("expected a second request after page-2, got %q", afters)
+	}
+	if _, ok := streams["2"]; !ok || len(streams) != 2 {
+		t.Errorf("expected the streams of both pages, got %v", streams)
+	}
+}
+
+func TestUnauthorizedRegeneratesTokenOnce(t *testing.T) {
+	var authorizations []string
+	client, getTokens := newTestTwitchClient(t, map[string]http.HandlerFunc{
+		domain.TwitchUsersPath: func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get(domain.TwitchAuthorizationHeader)
+			authorizations = append(authorizations, authorization)
+			if authorization == "Bearer token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			writeTestJson(t, w, domain.TwitchUsersResponse{Data: []domain.TwitchUserResponse{{ID: "1", Login: "streamer"}}})
+		},
+	})
+
+	users, err := client.GetTwitchUsers([]string{"1"})
+	if err != nil {
+		t.Fatalf("GetTwitchUsers failed: %v", err)
+	}
+
+	if getTokens() != 2 {
+		t.Errorf("expected the token to be generated twice, got %d", getTokens())
+	}
+	if len(authorizations) != 2 || authorizations[1] != "Bearer token-2" {
+		t.Errorf("expected a single retry with the new token, got %q", authorizations)
+	}
+	if users["1"].Login != "streamer" {
+		t.Errorf("expected the user of the retried request, got %v", users)
+	}
+}
+
+func TestTooManyRequestsWaitsForReset(t *testing.T) {
+	reset := time.Unix(time.Now().Unix()+1, 0)
+	var requestTimes []time.Time
+	client, _ := newTestTwitchClient(t, map[string]http.HandlerFunc{
+		domain.TwitchGamesPath: func(w http.ResponseWriter, r *http.Request) {
+			requestTimes = append(requestTimes, time.Now())
+			if len(requestTimes) == 1 {
+				w.Header().Set(domain.TwitchRateLimitLimitHeader, "800")
+				w.Header().Set(domain.TwitchRateLimitRemainingHeader, "0")
+				w.Header().Set(domain.TwitchRateLimitResetHeader, strconv.FormatInt(reset.Unix(), 10))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			writeTestJson(t, w, domain.TwitchGamesResponse{Data: []domain.TwitchGameResponse{{ID: "1"}}})
+		},
+	})
+
+	games, err := client.GetGames([]string{"1"})
+	if err != nil {
+		t.Fatalf("GetGames failed: %v", err)
+	}
+
+	if len(requestTimes) != 2 {
+		t.Fatalf("expected a single retry, got %d requests", len(requestTimes))
+	}
+	if requestTimes[1].Before(reset) {
+		t.Errorf("expected the retry after the reset at %s, got %s", reset, requestTimes[1])
+	}
+	if _, ok := games["1"]; !ok {
+		t.Errorf("expected the game of the retried request, got %v", games)
+	}
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"LiveStatus/src/domain"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by every Helix request of a twitchClient.
+// The bucket is refilled from the Ratelimit-* headers returned by Twitch, so it always follows the server view.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int // -1 while unknown
+	remaining int // -1 while unknown
+	resetAt   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limit:     -1,
+		remaining: -1,
+	}
+}
+
+// take blocks until a point is available in the bucket, then consumes it
+func (r *rateLimiter) take() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.remaining == 0 {
+		wait := time.Until(r.resetAt)
+		if wait <= 0 {
+			r.remaining = r.limit
+			break
+		}
+
+		r.mu.Unlock()
+		time.Sleep(wait)
+		r.mu.Lock()
+	}
+
+	if r.remaining > 0 {
+		r.remaining--
+	}
+}
+
+// update synchronizes the bucket with the rate limit headers of a Helix response
+func (r *rateLimiter) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get(domain.TwitchRateLimitRemainingHeader))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get(domain.TwitchRateLimitResetHeader), 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if limit, err := strconv.Atoi(header.Get(domain.TwitchRateLimitLimitHeader)); err == nil {
+		r.limit = limit
+	}
+	r.remaining = remaining
+	r.resetAt = time.Unix(reset, 0)
+}
+
+// exhaust empties the bucket after a 429, Twitch will refill it at resetAt
+func (r *rateLimiter) exhaust(header http.Header) {
+	r.update(header)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.remaining = 0
+	if r.resetAt.IsZero() || time.Now().After(r.resetAt) {
+		r.resetAt = time.Now().Add(domain.RetryDelay)
+	}
+}
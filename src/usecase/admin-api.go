@@ -0,0 +1,327 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AdminApi is the authenticated HTTP API used by operators, see openapi.yaml
+type AdminApi interface {
+	GetHandler() http.Handler
+}
+
+func NewAdminApi(configStore internal.ConfigStore, mapTwitchIdsToState *domain.LiveStates, database internal.Database, twClient internal.TwitchClient,
+	cron Cron, outbox NotificationOutbox, dcMessage DiscordMessage, dcCommand DiscordCommand, dcAdminCommand DiscordAdminCommand, health Health) AdminApi {
+	a := &adminApi{
+		configStore:         configStore,
+		mapTwitchIdsToState: mapTwitchIdsToState,
+		database:            database,
+		twClient:            twClient,
+		cron:                cron,
+		outbox:              outbox,
+		dcMessage:           dcMessage,
+		dcCommand:           dcCommand,
+		dcAdminCommand:      dcAdminCommand,
+		health:              health,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+domain.ApiOpenApiPath, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, domain.ApiOpenApiFile)
+	})
+	mux.Handle("GET "+domain.ApiBasePath+"/streamers", a.authenticate(a.listStreamers))
+	mux.Handle("GET "+domain.ApiBasePath+"/streamers/{twitchId}", a.authenticate(a.getStreamer))
+	mux.Handle("POST "+domain.ApiBasePath+"/streamers/{twitchId}/refresh", a.authenticate(a.refreshStreamer))
+	mux.Handle("POST "+domain.ApiBasePath+"/streamers/{twitchId}/announcements/{channelId}/repost", a.authenticate(a.repostAnnouncement))
+	mux.Handle("DELETE "+domain.ApiBasePath+"/streamers/{twitchId}/announcements/{channelId}", a.authenticate(a.deleteAnnouncement))
+	mux.Handle("GET "+domain.ApiBasePath+"/subscriptions", a.authenticate(a.listSubscriptions))
+	mux.Handle("GET "+domain.ApiBasePath+"/health", a.authenticate(a.getHealth))
+	mux.Handle("POST "+domain.ApiBasePath+"/commands/register", a.authenticate(a.registerCommands))
+	mux.Handle("GET "+domain.ApiBasePath+"/outbox", a.authenticate(a.listOutboxJobs))
+	mux.Handle("GET "+domain.ApiBasePath+"/outbox/dead", a.authenticate(a.listDeadOutboxJobs))
+	mux.Handle("POST "+domain.ApiBasePath+"/outbox/dead/{jobId}/retry", a.authenticate(a.retryDeadOutboxJob))
+	mux.Handle("DELETE "+domain.ApiBasePath+"/outbox/dead/{jobId}", a.authenticate(a.deleteDeadOutboxJob))
+	a.handler = mux
+
+	return a
+}
+
+type adminApi struct {
+	configStore         internal.ConfigStore
+	mapTwitchIdsToState *domain.LiveStates
+	database            internal.Database
+	twClient            internal.TwitchClient
+	cron                Cron
+	outbox              NotificationOutbox
+	dcMessage           DiscordMessage
+	dcCommand           DiscordCommand
+	dcAdminCommand      DiscordAdminCommand
+	health              Health
+	handler             http.Handler
+}
+
+func (a *adminApi) GetHandler() http.Handler {
+	return a.handler
+}
+
+// authenticate checks the bearer token against api.token, read on every request to follow config reloads
+func (a *adminApi) authenticate(next func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		expected := a.configStore.Get().Api.Token
+		if !ok || expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeApiJson(w, http.StatusUnauthorized, domain.ApiError{Error: "invalid or missing bearer token"})
+			return
+		}
+
+		if err := next(w, r); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, domain.ErrStreamerNotFound), errors.Is(err, domain.ErrAnnouncementNotFound), errors.Is(err, domain.ErrOutboxJobNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, domain.ErrStreamerOffline):
+				status = http.StatusConflict
+			default:
+				internal.HttpLog.Error("Admin API request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+			writeApiJson(w, status, domain.ApiError{Error: err.Error()})
+		}
+	})
+}
+
+func (a *adminApi) listStreamers(w http.ResponseWriter, _ *http.Request) error {
+	twitchIds := a.mapTwitchIdsToState.TwitchIds()
+	sort.Strings(twitchIds)
+
+	streamers := make([]domain.ApiStreamer, 0, len(twitchIds))
+	for _, twitchId := range twitchIds {
+		streamer, err := a.getApiStreamer(twitchId)
+		if errors.Is(err, domain.ErrStreamerNotFound) {
+			continue // Removed meanwhile
+		} else if err != nil {
+			return err
+		}
+		streamers = append(streamers, streamer)
+	}
+	writeApiJson(w, http.StatusOK, streamers)
+	return nil
+}
+
+func (a *adminApi) getStreamer(w http.ResponseWriter, r *http.Request) error {
+	streamer, err := a.getApiStreamer(r.PathValue(domain.ApiPathTwitchId))
+	if err != nil {
+		return err
+	}
+	writeApiJson(w, http.StatusOK, streamer)
+	return nil
+}
+
+// refreshStreamer fetches the stream from Helix and updates the messages and events like the RefreshTwitchStreams cron job
+func (a *adminApi) refreshStreamer(w http.ResponseWriter, r *http.Request) error {
+	twitchId := r.PathValue(domain.ApiPathTwitchId)
+	if err := a.cron.RefreshTwitchStream(twitchId); err != nil {
+		return err
+	}
+	internal.HttpLog.Info("Admin API refreshed streamer", "twitchId", twitchId)
+	return a.getStreamer(w, r)
+}
+
+// repostAnnouncement queues the deletion of the message of a live streamer then a new one, with its mention when the policy allows it
+func (a *adminApi) repostAnnouncement(w http.ResponseWriter, r *http.Request) error {
+	twitchId, channelId := r.PathValue(domain.ApiPathTwitchId), r.PathValue(domain.ApiPathChannel)
+	state, err := a.getAnnouncementState(twitchId, channelId)
+	if err != nil {
+		return err
+	} else if !state.IsOnline() {
+		return domain.ErrStreamerOffline
+	}
+
+	if err = a.dcMessage.RepostMessage(*state, channelId); err != nil {
+		return err
+	}
+	internal.HttpLog.Info("Admin API queued announcement repost", "twitchId", twitchId, "channelId", channelId)
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (a *adminApi) deleteAnnouncement(w http.ResponseWriter, r *http.Request) error {
+	twitchId, channelId := r.PathValue(domain.ApiPathTwitchId), r.PathValue(domain.ApiPathChannel)
+	if _, err := a.getAnnouncementState(twitchId, channelId); err != nil {
+		return err
+	}
+
+	if err := a.dcMessage.DeleteMessage(twitchId, channelId); err != nil {
+		return err
+	}
+	internal.HttpLog.Info("Admin API queued announcement deletion", "twitchId", twitchId, "channelId", channelId)
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (a *adminApi) listSubscriptions(w http.ResponseWriter, _ *http.Request) error {
+	statuses, err := a.twClient.GetSubscriber().GetSubscriptionStatuses()
+	if err != nil {
+		return err
+	}
+	writeApiJson(w, http.StatusOK, statuses)
+	return nil
+}
+
+// getHealth returns the readiness report with the failure of every check, the public readiness endpoint only answers
+// whether the application is ready
+func (a *adminApi) getHealth(w http.ResponseWriter, _ *http.Request) error {
+	writeApiJson(w, http.StatusOK, a.health.CheckReadiness())
+	return nil
+}
+
+// registerCommands registers again the live command of every guild and the global admin command
+func (a *adminApi) registerCommands(w http.ResponseWriter, _ *http.Request) error {
+	var guildIds []string
+	for guildId := range a.configStore.Get().Discord.Servers {
+		guildIds = append(guildIds, guildId)
+	}
+	if err := errors.Join(a.dcCommand.RegisterGuildCommands(guildIds), a.dcAdminCommand.RegisterCommands()); err != nil {
+		return err
+	}
+	internal.HttpLog.Info("Admin API registered commands", "guilds", len(guildIds))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (a *adminApi) listOutboxJobs(w http.ResponseWriter, _ *http.Request) error {
+	jobs, err := a.outbox.GetJobs()
+	if err != nil {
+		return err
+	}
+	writeApiJson(w, http.StatusOK, getApiOutboxJobs(jobs))
+	return nil
+}
+
+func (a *adminApi) listDeadOutboxJobs(w http.ResponseWriter, _ *http.Request) error {
+	jobs, err := a.outbox.GetDeadJobs()
+	if err != nil {
+		return err
+	}
+	writeApiJson(w, http.StatusOK, getApiOutboxJobs(jobs))
+	return nil
+}
+
+// retryDeadOutboxJob queues a dead letter again, after the pending jobs of its notifier
+func (a *adminApi) retryDeadOutboxJob(w http.ResponseWriter, r *http.Request) error {
+	jobId, err := strconv.ParseUint(r.PathValue(domain.ApiPathJobId), 10, 64)
+	if err != nil {
+		return domain.ErrOutboxJobNotFound
+	}
+	if err = a.outbox.RetryDeadJob(jobId); err != nil {
+		return err
+	}
+	internal.HttpLog.Info("Admin API retried dead outbox job", "jobId", jobId)
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (a *adminApi) deleteDeadOutboxJob(w http.ResponseWriter, r *http.Request) error {
+	jobId, err := strconv.ParseUint(r.PathValue(domain.ApiPathJobId), 10, 64)
+	if err != nil {
+		return domain.ErrOutboxJobNotFound
+	}
+	if err = a.outbox.DeleteDeadJob(jobId); err != nil {
+		return err
+	}
+	internal.HttpLog.Info("Admin API deleted dead outbox job", "jobId", jobId)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func getApiOutboxJobs(jobs []domain.OutboxJob) []domain.ApiOutboxJob {
+	apiJobs := make([]domain.ApiOutboxJob, 0, len(jobs))
+	for _, job := range jobs {
+		apiJobs = append(apiJobs, domain.NewApiOutboxJob(job))
+	}
+	return apiJobs
+}
+
+func (a *adminApi) getApiStreamer(twitchId string) (domain.ApiStreamer, error) {
+	state, ok := a.mapTwitchIdsToState.Get(twitchId)
+	if !ok {
+		return domain.ApiStreamer{}, domain.ErrStreamerNotFound
+	}
+
+	streamer := domain.ApiStreamer{
+		TwitchId:        state.TwitchId,
+		TwitchName:      state.TwitchName,
+		EventStreamType: state.EventStreamType,
+		Online:          state.IsOnline(),
+		Announcements:   []domain.ApiAnnouncement{},
+		Events:          []domain.ApiEvent{},
+	}
+	if state.IsOnline() {
+		startedAt := state.OnlineState.StartedAt
+		streamer.StreamType = state.OnlineState.Type
+		streamer.Title = state.OnlineState.Title
+		streamer.GameName = state.OnlineState.GameName
+		streamer.ViewerCount = state.OnlineState.ViewerCount
+		streamer.StartedAt = &startedAt
+	}
+
+	servers := a.configStore.Get().Discord.Servers
+	guildIds := make([]string, 0, len(servers))
+	for guildId := range servers {
+		guildIds = append(guildIds, guildId)
+	}
+	sort.Strings(guildIds)
+	for _, guildId := range guildIds {
+		for _, notifier := range servers[guildId] {
+			if notifier.TwitchId != twitchId {
+				continue
+			}
+
+			if notifier.Message.ChannelId != "" {
+				messageId, err := a.database.GetMessageId(twitchId, notifier.Message.ChannelId)
+				if err != nil {
+					return streamer, err
+				}
+				streamer.Announcements = append(streamer.Announcements, domain.ApiAnnouncement{GuildId: guildId, ChannelId: notifier.Message.ChannelId, MessageId: messageId})
+			}
+
+			event, err := a.database.GetEvent(twitchId, guildId)
+			if err != nil {
+				return streamer, err
+			} else if notifier.Event.Active || event.Id != "" {
+				streamer.Events = append(streamer.Events, domain.ApiEvent{GuildId: guildId, EventId: event.Id})
+			}
+		}
+	}
+	return streamer, nil
+}
+
+// getAnnouncementState returns the state of the streamer when the channel is one of its notifier channels
+func (a *adminApi) getAnnouncementState(twitchId string, channelId string) (*domain.LiveState, error) {
+	state, ok := a.mapTwitchIdsToState.Get(twitchId)
+	if !ok {
+		return nil, domain.ErrStreamerNotFound
+	}
+
+	for _, notifiers := range a.configStore.Get().Discord.Servers {
+		for _, notifier := range notifiers {
+			if notifier.TwitchId == twitchId && notifier.Message.ChannelId == channelId {
+				return state, nil
+			}
+		}
+	}
+	return nil, domain.ErrAnnouncementNotFound
+}
+
+func writeApiJson(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
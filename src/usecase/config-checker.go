@@ -0,0 +1,296 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+)
+
+// ConfigChecker checks the config against Twitch and Discord, the problems complete the ones of domain.Config Validate
+type ConfigChecker interface {
+	CheckTwitch(config domain.Config) domain.ConfigProblems
+	CheckDiscord(config domain.Config) domain.ConfigProblems
+	CheckGuild(guildId string, notifiers []domain.DiscordNotifier) domain.ConfigProblems
+	CheckWebhook(config domain.TwitchConfig) domain.ConfigProblems
+}
+
+func NewConfigChecker(twClient internal.TwitchClient, session *discordgo.Session, httpClient *http.Client) ConfigChecker {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &configChecker{
+		twClient:   twClient,
+		session:    session,
+		httpClient: httpClient,
+	}
+}
+
+type configChecker struct {
+	twClient   internal.TwitchClient
+	session    *discordgo.Session
+	httpClient *http.Client
+}
+
+type requiredPermission struct {
+	permission int64
+	name       string
+}
+
+var (
+	// announcementChannelTypes are the channels a notifier can post in, a forum gets a post by stream
+	announcementChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews, discordgo.ChannelTypeGuildForum}
+
+	messagePermissions = []requiredPermission{
+		{discordgo.PermissionViewChannel, "View Channel"},
+		{discordgo.PermissionSendMessages, "Send Messages"},
+		{discordgo.PermissionEmbedLinks, "Embed Links"},
+	}
+	mentionPermission = requiredPermission{discordgo.PermissionMentionEveryone, "Mention @everyone, @here and All Roles"}
+	eventPermission   = requiredPermission{discordgo.PermissionManageEvents, "Manage Events"}
+	threadPermissions = []requiredPermission{
+		{discordgo.PermissionCreatePublicThreads, "Create Public Threads"},
+		{discordgo.PermissionSendMessagesInThreads, "Send Messages in Threads"},
+		{discordgo.PermissionManageThreads, "Manage Threads"},
+	}
+	webhookPermission = requiredPermission{discordgo.PermissionManageWebhooks, "Manage Webhooks"}
+)
+
+// CheckTwitch checks that the credentials are accepted and that every streamer exists
+func (c *configChecker) CheckTwitch(config domain.Config) domain.ConfigProblems {
+	if err := c.twClient.Init(); err != nil {
+		return domain.ConfigProblems{{Path: "twitch.clientId", Message: fmt.Sprintf("credentials rejected by Twitch: %v", err)}}
+	}
+
+	mapIdToUser, err := c.twClient.GetTwitchUsers(config.Discord.GetAllTwitchIds())
+	if err != nil {
+		return domain.ConfigProblems{{Path: "twitch", Message: fmt.Sprintf("failed to get the streamers from Twitch: %v", err)}}
+	}
+
+	var problems domain.ConfigProblems
+	for guildId, notifiers := range config.Discord.Servers {
+		for index, notifier := range notifiers {
+			if _, ok := mapIdToUser[notifier.TwitchId]; !ok {
+				problems = append(problems, domain.ConfigProblem{
+					Path:    domain.NotifierConfigPath(guildId, index) + ".twitchId",
+					Message: fmt.Sprintf("Twitch user %s does not exist", notifier.TwitchId),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+// CheckDiscord checks that the bot is in every guild and has the permissions needed by the notifiers, only the REST API is used
+func (c *configChecker) CheckDiscord(config domain.Config) domain.ConfigProblems {
+	botUser, err := c.session.User("@me")
+	if err != nil {
+		return domain.ConfigProblems{{Path: "discord.token", Message: fmt.Sprintf("token rejected by Discord: %v", err)}}
+	}
+
+	var problems domain.ConfigProblems
+	for guildId, notifiers := range config.Discord.Servers {
+		problems = append(problems, c.checkGuild(botUser, guildId, notifiers)...)
+	}
+	return problems
+}
+
+// CheckGuild checks the notifiers of a guild, see CheckDiscord
+func (c *configChecker) CheckGuild(guildId string, notifiers []domain.DiscordNotifier) domain.ConfigProblems {
+	botUser, err := c.session.User("@me")
+	if err != nil {
+		return domain.ConfigProblems{{Path: "discord.token", Message: fmt.Sprintf("token rejected by Discord: %v", err)}}
+	}
+	return c.checkGuild(botUser, guildId, notifiers)
+}
+
+func (c *configChecker) checkGuild(botUser *discordgo.User, guildId string, notifiers []domain.DiscordNotifier) domain.ConfigProblems {
+	var problems domain.ConfigProblems
+	add := func(path string, format string, args ...any) {
+		problems = append(problems, domain.ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// A webhook URL posts without the bot, which may not be in the guild
+	if !slices.ContainsFunc(notifiers, needsBot) {
+		return problems
+	}
+
+	guildPath := fmt.Sprintf("discord.servers.%s", guildId)
+	guild, err := c.session.Guild(guildId)
+	if err != nil {
+		add(guildPath, "the bot %s is not in the guild: %v", botUser.Username, err)
+		return problems
+	}
+	member, err := c.session.GuildMember(guildId, botUser.ID)
+	if err != nil {
+		add(guildPath, "failed to get the bot member: %v", err)
+		return problems
+	}
+
+	for index, notifier := range notifiers {
+		path := domain.NotifierConfigPath(guildId, index)
+
+		if notifier.Event.Active {
+			if missing := getMissingPermissions(getGuildPermissions(guild, member), eventPermission); len(missing) > 0 {
+				add(path+".event.active", "the bot is missing the guild permissions: %s", strings.Join(missing, ", "))
+			}
+		}
+
+		var role *discordgo.Role
+		if roleMentionId := notifier.Message.RoleMentionId; roleMentionId != "" && !slices.Contains(domain.CustomMentions, roleMentionId) {
+			index := slices.IndexFunc(guild.Roles, func(guildRole *discordgo.Role) bool { return guildRole.ID == roleMentionId })
+			if index < 0 {
+				add(path+".message.roleMentionId", "role %s does not exist in the guild", roleMentionId)
+			} else {
+				role = guild.Roles[index]
+			}
+		}
+
+		if !notifier.Message.Active || notifier.Message.ChannelId == "" || notifier.Message.Webhook.Url != "" {
+			continue
+		}
+
+		channelPath := path + ".message.channelId"
+		channel, err := c.session.Channel(notifier.Message.ChannelId)
+		if err != nil {
+			add(channelPath, "channel %s is not visible by the bot: %v", notifier.Message.ChannelId, err)
+			continue
+		}
+		if channel.GuildID != guildId {
+			add(channelPath, "channel %s is not in the guild", channel.ID)
+			continue
+		}
+		forum := channel.Type == discordgo.ChannelTypeGuildForum
+		if !slices.Contains(announcementChannelTypes, channel.Type) {
+			add(channelPath, "channel #%s is not a text, announcement or forum channel", channel.Name)
+			continue
+		}
+
+		if notifier.Message.Crosspost && channel.Type != discordgo.ChannelTypeGuildNews {
+			add(path+".message.crosspost", "channel #%s is not an announcement channel", channel.Name)
+		}
+
+		permissions, err := c.session.UserChannelPermissions(botUser.ID, channel.ID)
+		if err != nil {
+			add(channelPath, "failed to compute the permissions of the bot: %v", err)
+			continue
+		}
+		required := slices.Clone(messagePermissions)
+		if slices.Contains(domain.CustomMentions, notifier.Message.RoleMentionId) || (role != nil && !role.Mentionable) {
+			required = append(required, mentionPermission)
+		}
+		if notifier.Message.Thread.Active || forum {
+			required = append(required, threadPermissions...)
+		}
+		if notifier.Message.Webhook.Active {
+			required = append(required, webhookPermission)
+		}
+		if missing := getMissingPermissions(permissions, required...); len(missing) > 0 {
+			add(channelPath, "the bot is missing the permissions in #%s: %s", channel.Name, strings.Join(missing, ", "))
+		}
+	}
+	return problems
+}
+
+// CheckWebhook sends a signed EventSub challenge to the webhook URL, like Twitch does when subscribing, and checks the answer
+func (c *configChecker) CheckWebhook(config domain.TwitchConfig) domain.ConfigProblems {
+	problem := func(format string, args ...any) domain.ConfigProblems {
+		return domain.ConfigProblems{{Path: "twitch.webhookUrl", Message: fmt.Sprintf(format, args...)}}
+	}
+
+	challenge, messageId := randomHex(16), randomHex(16)
+	body, err := json.Marshal(esb.SubscriptionChallenge{Challenge: challenge})
+	if err != nil {
+		return problem("failed to create the challenge: %v", err)
+	}
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+
+	mac := hmac.New(sha256.New, []byte(config.WebhookSecret))
+	mac.Write([]byte(messageId + timestamp))
+	mac.Write(body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), domain.DiagnosticsWebhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return problem("invalid webhook URL: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(domain.TwitchEventSubMessageIdHeader, messageId)
+	request.Header.Set(domain.TwitchEventSubMessageRetryHeader, "0")
+	request.Header.Set(domain.TwitchEventSubMessageTypeHeader, domain.TwitchWebhookVerificationType)
+	request.Header.Set(domain.TwitchEventSubMessageTimestampHeader, timestamp)
+	request.Header.Set(domain.TwitchEventSubMessageSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return problem("webhook unreachable: %v", err)
+	}
+	defer response.Body.Close()
+
+	answer, err := io.ReadAll(io.LimitReader(response.Body, 1024))
+	if err != nil {
+		return problem("failed to read the webhook answer: %v", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return problem("webhook answered the challenge with status %d (check webhookSecret and the reverse proxy)", response.StatusCode)
+	}
+	if string(answer) != challenge {
+		return problem("webhook did not answer the challenge, is the URL routed to LiveStatus?")
+	}
+	return nil
+}
+
+// getGuildPermissions computes the permissions of a member at the guild level, without channel overwrites
+func getGuildPermissions(guild *discordgo.Guild, member *discordgo.Member) int64 {
+	if guild.OwnerID == member.User.ID {
+		return discordgo.PermissionAll
+	}
+
+	var permissions int64
+	for _, role := range guild.Roles {
+		if role.ID == guild.ID || slices.Contains(member.Roles, role.ID) {
+			permissions |= role.Permissions
+		}
+	}
+	if permissions&discordgo.PermissionAdministrator != 0 {
+		return discordgo.PermissionAll
+	}
+	return permissions
+}
+
+// needsBot reports whether the notifier is delivered by the bot, a notifier posting with a webhook URL and without event is not
+func needsBot(notifier domain.DiscordNotifier) bool {
+	return notifier.Event.Active || notifier.Message.Webhook.Url == ""
+}
+
+func getMissingPermissions(permissions int64, required ...requiredPermission) []string {
+	var missing []string
+	for _, permission := range required {
+		if permissions&permission.permission != permission.permission {
+			missing = append(missing, permission.name)
+		}
+	}
+	return missing
+}
+
+func randomHex(size int) string {
+	value := make([]byte, size)
+	_, _ = rand.Read(value)
+	return hex.EncodeToString(value)
+}
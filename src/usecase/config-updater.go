@@ -0,0 +1,301 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+type ConfigUpdater interface {
+	Apply(fileConfig *domain.Config) error
+	SetNotifier(guildId string, notifier domain.DiscordNotifier) error
+	RemoveNotifier(guildId string, twitchId string) error
+	IsFileNotifier(guildId string, twitchId string) bool
+}
+
+func NewConfigUpdater(fileConfig *domain.Config, configStore internal.ConfigStore, database internal.Database, twClient internal.TwitchClient,
+	mapTwitchIdsToState *domain.LiveStates, dcCommand DiscordCommand, newLiveState func(twitchId string, twitchName string) *domain.LiveState, metrics *internal.Metrics) ConfigUpdater {
+	return &configUpdater{
+		fileConfig:          fileConfig,
+		configStore:         configStore,
+		database:            database,
+		twClient:            twClient,
+		mapTwitchIdsToState: mapTwitchIdsToState,
+		dcCommand:           dcCommand,
+		newLiveState:        newLiveState,
+		metrics:             metrics,
+	}
+}
+
+type configUpdater struct {
+	mu                  sync.Mutex
+	fileConfig          *domain.Config // config.yaml, without the notifiers stored in database
+	configStore         internal.ConfigStore
+	database            internal.Database
+	twClient            internal.TwitchClient
+	mapTwitchIdsToState *domain.LiveStates
+	dcCommand           DiscordCommand
+	newLiveState        func(twitchId string, twitchName string) *domain.LiveState
+	metrics             *internal.Metrics
+}
+
+// Apply replaces the yaml config and applies the difference with the running config
+func (c *configUpdater) Apply(fileConfig *domain.Config) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.apply(fileConfig)
+	return err
+}
+
+// SetNotifier adds or replaces the notifier of a streamer in a guild, the notifier is stored in database. A notifier of
+// config.yaml is edited in the file, a stored copy would hide its later changes.
+func (c *configUpdater) SetNotifier(guildId string, notifier domain.DiscordNotifier) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isFileNotifier(guildId, notifier.TwitchId) {
+		return domain.ErrNotifierInConfigFile
+	}
+
+	return c.updateStoredNotifiers(guildId, func(notifiers []domain.DiscordNotifier) ([]domain.DiscordNotifier, error) {
+		index := slices.IndexFunc(notifiers, func(stored domain.DiscordNotifier) bool { return stored.TwitchId == notifier.TwitchId })
+		if index >= 0 {
+			notifiers[index] = notifier
+			return notifiers, nil
+		}
+		return append(notifiers, notifier), nil
+	})
+}
+
+// RemoveNotifier removes a notifier stored in database, a notifier of config.yaml is restored if it was overridden
+// and can't be removed otherwise
+func (c *configUpdater) RemoveNotifier(guildId string, twitchId string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.updateStoredNotifiers(guildId, func(notifiers []domain.DiscordNotifier) ([]domain.DiscordNotifier, error) {
+		index := slices.IndexFunc(notifiers, func(stored domain.DiscordNotifier) bool { return stored.TwitchId == twitchId })
+		if index < 0 && c.isFileNotifier(guildId, twitchId) {
+			return nil, domain.ErrNotifierInConfigFile
+		} else if index < 0 {
+			return nil, domain.ErrNotifierNotFound
+		}
+		return slices.Delete(notifiers, index, index+1), nil
+	})
+}
+
+func (c *configUpdater) IsFileNotifier(guildId string, twitchId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isFileNotifier(guildId, twitchId)
+}
+
+func (c *configUpdater) isFileNotifier(guildId string, twitchId string) bool {
+	return c.fileConfig.Discord.FindNotifierByGuildIdAndTwitchId(guildId, twitchId) != nil
+}
+
+// updateStoredNotifiers saves the updated notifiers of the guild then applies them, the database is restored if the config can't be applied
+func (c *configUpdater) updateStoredNotifiers(guildId string, update func(notifiers []domain.DiscordNotifier) ([]domain.DiscordNotifier, error)) error {
+	storedServers, err := c.database.GetAllGuildNotifiers()
+	if err != nil {
+		return err
+	}
+
+	previousNotifiers := storedServers[guildId]
+	notifiers, err := update(slices.Clone(previousNotifiers))
+	if err != nil {
+		return err
+	}
+
+	if err = c.database.SetGuildNotifiers(guildId, notifiers); err != nil {
+		return err
+	}
+
+	applied, err := c.apply(c.fileConfig)
+	if err != nil && !applied {
+		if restoreErr := c.database.SetGuildNotifiers(guildId, previousNotifiers); restoreErr != nil {
+			return errors.Join(err, restoreErr)
+		}
+	}
+	return err
+}
+
+// apply computes the new config and applies the difference with the running one, applied is false when the running config was kept
+func (c *configUpdater) apply(fileConfig *domain.Config) (bool, error) {
+	storedServers, err := c.database.GetAllGuildNotifiers()
+	if err != nil {
+		return false, err
+	}
+
+	oldConfig := c.configStore.Get()
+	newConfig := fileConfig.MergeNotifiers(storedServers)
+
+	oldTwitchIds := oldConfig.Discord.GetAllTwitchIds()
+	newTwitchIds := newConfig.Discord.GetAllTwitchIds()
+	addedTwitchIds := difference(newTwitchIds, oldTwitchIds)
+	removedTwitchIds := difference(oldTwitchIds, newTwitchIds)
+
+	// Resolve the names of the new broadcasters, a streamer that does not exist rejects the whole config
+	newConfig.Twitch.UserResolver = make(map[string]domain.TwitchUserResolver)
+	for _, twitchId := range newTwitchIds {
+		if userResolver, ok := oldConfig.Twitch.UserResolver[twitchId]; ok {
+			newConfig.Twitch.UserResolver[twitchId] = userResolver
+		}
+	}
+	if len(addedTwitchIds) > 0 {
+		mapIdToUser, err := c.twClient.GetTwitchUsers(addedTwitchIds)
+		if err != nil {
+			return false, err
+		}
+		for _, twitchId := range addedTwitchIds {
+			twitchUser, ok := mapIdToUser[twitchId]
+			if !ok {
+				return false, fmt.Errorf("twitch user %s not found", twitchId)
+			}
+			newConfig.Twitch.UserResolver[twitchId] = domain.TwitchUserResolver{
+				TwitchId:              twitchId,
+				TwitchName:            twitchUser.Login,
+				TwitchDisplayName:     twitchUser.DisplayName,
+				TwitchProfileImageUrl: twitchUser.ProfileImageUrl,
+			}
+		}
+	}
+
+	subscriber := c.twClient.GetSubscriber()
+	if len(addedTwitchIds) > 0 {
+		totalCost, maxTotalCost, err := subscriber.SubscribeAll(addedTwitchIds)
+		if err != nil {
+			return false, errors.Join(err, subscriber.Unsubscribe(addedTwitchIds))
+		}
+		c.metrics.SetSubscriptionCost(totalCost, maxTotalCost)
+		internal.ConfigLog.Info("Subscribed to new broadcasters", "twitchIds", addedTwitchIds, "totalCost", totalCost, "maxTotalCost", maxTotalCost)
+	}
+
+	// The removed broadcasters go offline while their notifiers are still in the running config, their announcements
+	// and events are not left live
+	var errs []error
+	for _, twitchId := range removedTwitchIds {
+		if state, ok := c.mapTwitchIdsToState.Get(twitchId); ok && state.IsOnline() && state.TriggerFunction != nil {
+			offlineState := *state
+			offlineState.OnlineState.IsLive = false
+			if err := state.TriggerFunction(offlineState); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	c.configStore.Set(newConfig)
+	c.fileConfig = fileConfig
+
+	if len(removedTwitchIds) > 0 {
+		if err := subscriber.Unsubscribe(removedTwitchIds); err != nil {
+			errs = append(errs, err)
+		}
+		for _, twitchId := range removedTwitchIds {
+			c.mapTwitchIdsToState.Delete(twitchId)
+		}
+		internal.ConfigLog.Info("Unsubscribed from broadcasters", "twitchIds", removedTwitchIds)
+	}
+
+	changedGuildIds, changedTwitchIds := diffServers(oldConfig.Discord.Servers, newConfig.Discord.Servers)
+
+	if len(addedTwitchIds) > 0 {
+		if err := c.initLiveStates(addedTwitchIds, newConfig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Refresh the messages and events of the streamers whose notifiers changed
+	for _, twitchId := range changedTwitchIds {
+		if state, ok := c.mapTwitchIdsToState.Get(twitchId); ok && !slices.Contains(addedTwitchIds, twitchId) && state.IsOnline() && state.TriggerFunction != nil {
+			if err := state.TriggerFunction(*state); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(changedGuildIds) > 0 {
+		if err := c.dcCommand.RegisterGuildCommands(changedGuildIds); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return true, errors.Join(errs...)
+}
+
+func (c *configUpdater) initLiveStates(twitchIds []string, config *domain.Config) error {
+	streams, err := c.twClient.GetStreams(twitchIds)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, twitchId := range twitchIds {
+		liveState := c.newLiveState(twitchId, config.Twitch.UserResolver[twitchId].TwitchName)
+		c.mapTwitchIdsToState.Set(liveState)
+
+		if stream, ok := streams[twitchId]; ok {
+			err = liveState.SetLiveState(&stream)
+		} else {
+			err = liveState.SetLiveState(nil)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// diffServers returns the guilds and the streamers whose notifiers changed
+func diffServers(oldServers map[string][]domain.DiscordNotifier, newServers map[string][]domain.DiscordNotifier) ([]string, []string) {
+	var guildIds, twitchIds []string
+	addTwitchIds := func(notifiers []domain.DiscordNotifier) {
+		for _, notifier := range notifiers {
+			if !slices.Contains(twitchIds, notifier.TwitchId) {
+				twitchIds = append(twitchIds, notifier.TwitchId)
+			}
+		}
+	}
+
+	for guildId, newNotifiers := range newServers {
+		oldNotifiers := oldServers[guildId]
+		if reflect.DeepEqual(oldNotifiers, newNotifiers) {
+			continue
+		}
+		guildIds = append(guildIds, guildId)
+
+		for _, newNotifier := range newNotifiers {
+			index := slices.IndexFunc(oldNotifiers, func(old domain.DiscordNotifier) bool { return old.TwitchId == newNotifier.TwitchId })
+			if index < 0 || !reflect.DeepEqual(oldNotifiers[index], newNotifier) {
+				addTwitchIds([]domain.DiscordNotifier{newNotifier})
+			}
+		}
+		for _, oldNotifier := range oldNotifiers {
+			if !slices.ContainsFunc(newNotifiers, func(notifier domain.DiscordNotifier) bool { return notifier.TwitchId == oldNotifier.TwitchId }) {
+				addTwitchIds([]domain.DiscordNotifier{oldNotifier})
+			}
+		}
+	}
+
+	for guildId, oldNotifiers := range oldServers {
+		if _, ok := newServers[guildId]; !ok {
+			guildIds = append(guildIds, guildId)
+			addTwitchIds(oldNotifiers)
+		}
+	}
+
+	return guildIds, twitchIds
+}
+
+func difference(values []string, excluded []string) []string {
+	var result []string
+	for _, value := range values {
+		if !slices.Contains(excluded, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -4,17 +4,19 @@ import (
 	"LiveStatus/src/domain"
 	"LiveStatus/src/internal"
 	"errors"
-	"log"
 )
 
 type Cron interface {
 	RefreshDiscordEvent() error
+	ArchiveDiscordThreads() error
 	RefreshTwitchStreams() error
+	RefreshTwitchStream(twitchId string) error
 }
 
-func NewCron(eventInstance DiscordEvent, mapTwitchIdsToState map[string]*domain.LiveState, twClient internal.TwitchClient) Cron {
+func NewCron(eventInstance DiscordEvent, messageInstance DiscordMessage, mapTwitchIdsToState *domain.LiveStates, twClient internal.TwitchClient) Cron {
 	return &cron{
 		eventInstance:       eventInstance,
+		messageInstance:     messageInstance,
 		mapTwitchIdsToState: mapTwitchIdsToState,
 		twClient:            twClient,
 	}
@@ -22,14 +24,15 @@ func NewCron(eventInstance DiscordEvent, mapTwitchIdsToState map[string]*domain.
 
 type cron struct {
 	eventInstance       DiscordEvent
-	mapTwitchIdsToState map[string]*domain.LiveState
+	messageInstance     DiscordMessage
+	mapTwitchIdsToState *domain.LiveStates
 	twClient            internal.TwitchClient
 }
 
-// RefreshDiscordEvent updates events to update the end date
+// RefreshDiscordEvent renews the end time of the live events close to ending, the others are left untouched
 func (c cron) RefreshDiscordEvent() error {
 	var errs []error
-	for _, state := range c.mapTwitchIdsToState {
+	for _, state := range c.mapTwitchIdsToState.All() {
 		if err := c.eventInstance.HandleLiveState(*state); err != nil {
 			errs = append(errs, err)
 		}
@@ -38,13 +41,25 @@ func (c cron) RefreshDiscordEvent() error {
 	return errors.Join(errs...)
 }
 
+// ArchiveDiscordThreads archives the threads of the ended streams, see domain.ThreadPolicy
+func (c cron) ArchiveDiscordThreads() error {
+	return c.messageInstance.ArchiveThreads()
+}
+
 // RefreshTwitchStreams used to fix sync issues with twitch EventSub
 func (c cron) RefreshTwitchStreams() error {
-	var twitchIds []string
-	for twitchId := range c.mapTwitchIdsToState {
-		twitchIds = append(twitchIds, twitchId)
+	return c.refreshTwitchStreams(c.mapTwitchIdsToState.TwitchIds(), false)
+}
+
+// RefreshTwitchStream refreshes a streamer like RefreshTwitchStreams, its messages and events are updated even when it stays offline
+func (c cron) RefreshTwitchStream(twitchId string) error {
+	if _, ok := c.mapTwitchIdsToState.Get(twitchId); !ok {
+		return domain.ErrStreamerNotFound
 	}
+	return c.refreshTwitchStreams([]string{twitchId}, true)
+}
 
+func (c cron) refreshTwitchStreams(twitchIds []string, force bool) error {
 	if len(twitchIds) == 0 {
 		return nil
 	}
@@ -56,27 +71,33 @@ func (c cron) RefreshTwitchStreams() error {
 
 	var errs []error
 	var updatedTwitchId = map[bool][]string{true: {}, false: {}}
-	for twitchId, state := range c.mapTwitchIdsToState {
+	for _, twitchId := range twitchIds {
+		state, stateOk := c.mapTwitchIdsToState.Get(twitchId)
+		if !stateOk {
+			continue
+		}
+
 		var setLiveStateErr error
 		if stream, streamOk := streams[twitchId]; streamOk {
 			setLiveStateErr = state.SetLiveState(&stream)
 			updatedTwitchId[true] = append(updatedTwitchId[true], twitchId)
-		} else if state.IsOnline() {
+		} else if state.IsOnline() || force {
+			state.EventStreamType = ""
 			setLiveStateErr = state.SetLiveState(nil)
 			updatedTwitchId[false] = append(updatedTwitchId[false], twitchId)
 		}
 
 		if setLiveStateErr != nil {
 			errs = append(errs, setLiveStateErr)
-			log.Printf("ERROR RefreshTwitchStreams SetLiveState (twitchId=%s): %v", twitchId, setLiveStateErr)
+			internal.CronLog.Error("RefreshTwitchStreams SetLiveState failed", "twitchId", twitchId, "error", setLiveStateErr)
 		}
 	}
 
 	if mapTwitchIds, ok := updatedTwitchId[true]; ok && len(mapTwitchIds) > 0 {
-		log.Printf("RefreshTwitchStreams SetLiveState online (twitchIds=%s)\n", mapTwitchIds)
+		internal.CronLog.Info("RefreshTwitchStreams SetLiveState online", "twitchIds", mapTwitchIds)
 	}
 	if mapTwitchIds, ok := updatedTwitchId[false]; ok && len(mapTwitchIds) > 0 {
-		log.Printf("RefreshTwitchStreams SetLiveState offline (twitchIds=%s)\n", mapTwitchIds)
+		internal.CronLog.Info("RefreshTwitchStreams SetLiveState offline", "twitchIds", mapTwitchIds)
 	}
 
 	return errors.Join(errs...)
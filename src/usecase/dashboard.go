@@ -0,0 +1,400 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// Dashboard is the web UI of the guild admins, logged in with Discord OAuth2
+type Dashboard interface {
+	GetHandler() http.Handler
+}
+
+func NewDashboard(configStore internal.ConfigStore, configUpdater ConfigUpdater, mapTwitchIdsToState *domain.LiveStates, database internal.Database,
+	dcSession *discordgo.Session, dcMessage DiscordMessage, i18n internal.I18n, oauth internal.DiscordOAuth) Dashboard {
+	d := &dashboard{
+		configStore:         configStore,
+		configUpdater:       configUpdater,
+		mapTwitchIdsToState: mapTwitchIdsToState,
+		database:            database,
+		dcSession:           dcSession,
+		dcMessage:           dcMessage,
+		i18n:                i18n,
+		oauth:               oauth,
+		sessions:            make(map[string]*dashboardSession),
+	}
+
+	static, _ := fs.Sub(dashboardFiles, "dashboard")
+	mux := http.NewServeMux()
+	mux.Handle("GET "+domain.DashboardPath+"/", http.StripPrefix(domain.DashboardPath, http.FileServerFS(static)))
+	mux.HandleFunc("GET "+domain.DashboardPath+"/login", d.login)
+	mux.HandleFunc("GET "+domain.DashboardPath+"/callback", d.callback)
+	mux.HandleFunc("POST "+domain.DashboardPath+"/logout", d.logout)
+	mux.Handle("GET "+domain.DashboardPath+"/api/me", d.authenticate(d.getMe))
+	mux.Handle("GET "+domain.DashboardPath+"/api/guilds/{guildId}", d.authenticate(d.getGuild))
+	mux.Handle("PUT "+domain.DashboardPath+"/api/guilds/{guildId}/notifiers/{twitchId}", d.authenticate(d.updateNotifier))
+	mux.Handle("POST "+domain.DashboardPath+"/api/guilds/{guildId}/notifiers/{twitchId}/preview", d.authenticate(d.previewNotifier))
+	d.handler = mux
+
+	return d
+}
+
+type dashboard struct {
+	configStore         internal.ConfigStore
+	configUpdater       ConfigUpdater
+	mapTwitchIdsToState *domain.LiveStates
+	database            internal.Database
+	dcSession           *discordgo.Session
+	dcMessage           DiscordMessage
+	i18n                internal.I18n
+	oauth               internal.DiscordOAuth
+	handler             http.Handler
+
+	mu       sync.Mutex
+	sessions map[string]*dashboardSession // Key is the session cookie, lost on restart
+}
+
+type dashboardSession struct {
+	user      domain.DiscordOAuthUser // Guilds are filtered on login, see getManagedGuilds
+	expiresAt time.Time
+}
+
+func (d *dashboard) GetHandler() http.Handler {
+	return d.handler
+}
+
+// login redirects to the Discord authorization page, the state cookie protects the callback against CSRF
+func (d *dashboard) login(w http.ResponseWriter, r *http.Request) {
+	config := d.configStore.Get().Dashboard
+	state := newDashboardToken()
+	d.setCookie(w, domain.DashboardStateCookie, state, domain.DashboardStateTtl)
+	http.Redirect(w, r, d.oauth.GetAuthorizeUrl(config.ClientId, d.getRedirectUrl(), state), http.StatusFound)
+}
+
+func (d *dashboard) callback(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie(domain.DashboardStateCookie)
+	if err != nil || r.URL.Query().Get("state") == "" || stateCookie.Value != r.URL.Query().Get("state") {
+		http.Error(w, "invalid OAuth2 state, try to log in again", http.StatusBadRequest)
+		return
+	}
+	d.setCookie(w, domain.DashboardStateCookie, "", -1)
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Discord login cancelled: "+r.URL.Query().Get("error_description"), http.StatusBadRequest)
+		return
+	}
+
+	config := d.configStore.Get().Dashboard
+	user, err := d.oauth.GetUser(config.ClientId, config.ClientSecret, d.getRedirectUrl(), code)
+	if err != nil {
+		internal.HttpLog.Error("Dashboard login failed", "error", err)
+		http.Error(w, "Discord login failed", http.StatusBadGateway)
+		return
+	}
+	user.Guilds = d.getManagedGuilds(user.Guilds)
+
+	sessionId := newDashboardToken()
+	d.mu.Lock()
+	for id, session := range d.sessions {
+		if time.Now().After(session.expiresAt) {
+			delete(d.sessions, id)
+		}
+	}
+	d.sessions[sessionId] = &dashboardSession{user: *user, expiresAt: time.Now().Add(domain.DashboardSessionTtl)}
+	d.mu.Unlock()
+
+	internal.HttpLog.Info("Dashboard login", "userId", user.Id, "username", user.Username, "guilds", len(user.Guilds))
+	d.setCookie(w, domain.DashboardSessionCookie, sessionId, domain.DashboardSessionTtl)
+	http.Redirect(w, r, strings.TrimSuffix(config.PublicUrl, "/")+"/", http.StatusFound)
+}
+
+func (d *dashboard) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(domain.DashboardSessionCookie); err == nil {
+		d.mu.Lock()
+		delete(d.sessions, cookie.Value)
+		d.mu.Unlock()
+	}
+	d.setCookie(w, domain.DashboardSessionCookie, "", -1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate resolves the session of the cookie and checks the guild access when the path has a guildId
+func (d *dashboard) authenticate(next func(w http.ResponseWriter, r *http.Request, user domain.DiscordOAuthUser) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var session *dashboardSession
+		if cookie, err := r.Cookie(domain.DashboardSessionCookie); err == nil {
+			d.mu.Lock()
+			session = d.sessions[cookie.Value]
+			d.mu.Unlock()
+		}
+		if session == nil || time.Now().After(session.expiresAt) {
+			writeApiJson(w, http.StatusUnauthorized, domain.ApiError{Error: "not logged in"})
+			return
+		}
+		// Forms can't send JSON across sites, the SameSite cookie already blocks the other cross-site requests
+		if r.Method != http.MethodGet && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			writeApiJson(w, http.StatusUnsupportedMediaType, domain.ApiError{Error: "JSON body expected"})
+			return
+		}
+
+		err := d.checkGuildAccess(session.user, r.PathValue("guildId"))
+		if err == nil {
+			err = next(w, r, session.user)
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, domain.ErrDashboardForbidden):
+				status = http.StatusForbidden
+			case errors.Is(err, domain.ErrNotifierNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, domain.ErrInvalidNotifierSettings):
+				status = http.StatusBadRequest
+			case errors.Is(err, domain.ErrNotifierInConfigFile):
+				status = http.StatusConflict
+			default:
+				internal.HttpLog.Error("Dashboard request failed", "method", r.Method, "path", r.URL.Path, "userId", session.user.Id, "error", err)
+			}
+			writeApiJson(w, status, domain.ApiError{Error: err.Error()})
+		}
+	})
+}
+
+// checkGuildAccess checks with the bot that the user still has the Manage Server permission, the login snapshot can be outdated
+func (d *dashboard) checkGuildAccess(user domain.DiscordOAuthUser, guildId string) error {
+	if guildId == "" {
+		return nil
+	}
+	if !slices.ContainsFunc(user.Guilds, func(guild domain.DiscordOAuthGuild) bool { return guild.Id == guildId }) {
+		return domain.ErrDashboardForbidden
+	}
+
+	guild, err := d.dcSession.State.Guild(guildId)
+	if err != nil {
+		return domain.ErrDashboardForbidden // The bot left the guild
+	}
+	member, err := d.dcSession.GuildMember(guildId, user.Id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrDashboardForbidden, err)
+	}
+	if getGuildPermissions(guild, member)&discordgo.PermissionManageServer == 0 {
+		return domain.ErrDashboardForbidden
+	}
+	return nil
+}
+
+func (d *dashboard) getMe(w http.ResponseWriter, _ *http.Request, user domain.DiscordOAuthUser) error {
+	writeApiJson(w, http.StatusOK, user)
+	return nil
+}
+
+func (d *dashboard) getGuild(w http.ResponseWriter, r *http.Request, _ domain.DiscordOAuthUser) error {
+	guildId := r.PathValue("guildId")
+	guild, err := d.dcSession.State.Guild(guildId)
+	if err != nil {
+		return err
+	}
+
+	result := domain.DashboardGuild{
+		Id:            guildId,
+		Name:          guild.Name,
+		Langs:         d.i18n.GetLangs(),
+		Channels:      []domain.DashboardOption{},
+		Roles:         []domain.DashboardOption{},
+		Notifiers:     []domain.DashboardNotifier{},
+		Sessions:      make(map[string][]domain.StreamSession),
+		Notifications: []domain.NotificationRecord{},
+	}
+
+	channels := slices.Clone(guild.Channels)
+	sort.SliceStable(channels, func(i, j int) bool { return channels[i].Position < channels[j].Position })
+	for _, channel := range channels {
+		if slices.Contains(announcementChannelTypes, channel.Type) {
+			result.Channels = append(result.Channels, domain.DashboardOption{Id: channel.ID, Name: channel.Name})
+		}
+	}
+	for _, role := range guild.Roles {
+		if role.ID != guildId && !role.Managed { // @everyone has the guild id, see domain.CustomMentions
+			result.Roles = append(result.Roles, domain.DashboardOption{Id: role.ID, Name: role.Name})
+		}
+	}
+
+	config := d.configStore.Get()
+	for _, notifier := range config.Discord.Servers[guildId] {
+		dashboardNotifier := domain.DashboardNotifier{
+			TwitchId:   notifier.TwitchId,
+			TwitchName: config.Twitch.UserResolver[notifier.TwitchId].TwitchDisplayName,
+			Source:     "discord",
+			Settings:   domain.NewDashboardNotifierInput(notifier),
+		}
+		if d.configUpdater.IsFileNotifier(guildId, notifier.TwitchId) {
+			dashboardNotifier.Source = "config"
+		}
+		if state, ok := d.mapTwitchIdsToState.Get(notifier.TwitchId); ok && state.IsOnline() {
+			dashboardNotifier.Online = true
+			dashboardNotifier.StreamTitle = state.OnlineState.Title
+			dashboardNotifier.GameName = state.OnlineState.GameName
+		}
+		result.Notifiers = append(result.Notifiers, dashboardNotifier)
+
+		sessions, err := d.database.GetStreamSessions(notifier.TwitchId)
+		if err != nil {
+			return err
+		}
+		slices.Reverse(sessions)
+		result.Sessions[notifier.TwitchId] = sessions
+	}
+
+	notifications, err := d.database.GetNotificationRecords(guildId)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(notifications)
+	result.Notifications = append(result.Notifications, notifications...)
+
+	writeApiJson(w, http.StatusOK, result)
+	return nil
+}
+
+// updateNotifier saves the notifier in database like /livestatus set, a notifier of config.yaml is read-only
+func (d *dashboard) updateNotifier(w http.ResponseWriter, r *http.Request, user domain.DiscordOAuthUser) error {
+	guildId := r.PathValue("guildId")
+	notifier, err := d.getEditedNotifier(r)
+	if err != nil {
+		return err
+	}
+
+	if err = d.configUpdater.SetNotifier(guildId, *notifier); err != nil {
+		return err
+	}
+	internal.HttpLog.Info("Dashboard updated notifier", "guildId", guildId, "twitchId", notifier.TwitchId, "userId", user.Id)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// previewNotifier renders the online and offline embeds of the edited notifier, a sample stream is used when the streamer is offline
+func (d *dashboard) previewNotifier(w http.ResponseWriter, r *http.Request, _ domain.DiscordOAuthUser) error {
+	notifier, err := d.getEditedNotifier(r)
+	if err != nil {
+		return err
+	}
+
+	state := domain.LiveState{TwitchId: notifier.TwitchId, TwitchName: d.configStore.Get().Twitch.UserResolver[notifier.TwitchId].TwitchName}
+	if current, ok := d.mapTwitchIdsToState.Get(notifier.TwitchId); ok {
+		state = *current
+	}
+
+	online := state
+	if !online.IsOnline() {
+		online.OnlineState = domain.OnlineState{
+			IsLive:         true,
+			Type:           domain.StreamTypeLive,
+			Title:          "Preview",
+			StartedAt:      time.Now(),
+			StreamImageUrl: domain.FormatTwitchImageUrl(fmt.Sprintf(domain.TwitchPreviewUrl, url.PathEscape(state.TwitchName)), domain.StreamImageWidth, domain.StreamImageHeight),
+		}
+	}
+	offline := state
+	offline.OnlineState.IsLive = false
+
+	rule, _ := notifier.GetStreamTypeRule(online.OnlineState.Type)
+	writeApiJson(w, http.StatusOK, map[string]*discordgo.MessageEmbed{
+		"online":  d.dcMessage.getEmbed(notifier.Lang, rule.Template, notifier.FilterLiveState(online)),
+		"offline": d.dcMessage.getEmbed(notifier.Lang, rule.Template, notifier.FilterLiveState(offline)),
+	})
+	return nil
+}
+
+// getEditedNotifier returns a copy of the notifier of the path with the settings of the body, the settings are validated against the guild
+func (d *dashboard) getEditedNotifier(r *http.Request) (*domain.DiscordNotifier, error) {
+	guildId, twitchId := r.PathValue("guildId"), r.PathValue("twitchId")
+	notifier := d.configStore.Get().Discord.FindNotifierByGuildIdAndTwitchId(guildId, twitchId)
+	if notifier == nil {
+		return nil, domain.ErrNotifierNotFound
+	}
+	edited := *notifier
+
+	var input domain.DashboardNotifierInput
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<16)).Decode(&input); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidNotifierSettings, err)
+	}
+	if !slices.Contains(d.i18n.GetLangs(), input.Lang) {
+		return nil, fmt.Errorf("%w: unknown lang %q", domain.ErrInvalidNotifierSettings, input.Lang)
+	}
+
+	guild, err := d.dcSession.State.Guild(guildId)
+	if err != nil {
+		return nil, err
+	}
+	isAnnouncementChannel := func(channel *discordgo.Channel) bool {
+		return channel.ID == input.ChannelId && slices.Contains(announcementChannelTypes, channel.Type)
+	}
+	if input.ChannelId != "" && !slices.ContainsFunc(guild.Channels, isAnnouncementChannel) {
+		return nil, fmt.Errorf("%w: channel %s is not a text, announcement or forum channel of the guild", domain.ErrInvalidNotifierSettings, input.ChannelId)
+	}
+	if input.RoleMentionId != "" && !slices.Contains(domain.CustomMentions, input.RoleMentionId) &&
+		!slices.ContainsFunc(guild.Roles, func(role *discordgo.Role) bool { return role.ID == input.RoleMentionId }) {
+		return nil, fmt.Errorf("%w: role %s is not in the guild", domain.ErrInvalidNotifierSettings, input.RoleMentionId)
+	}
+
+	input.Apply(&edited)
+	return &edited, nil
+}
+
+// getManagedGuilds keeps the guilds where the user has the Manage Server permission and the bot is present
+func (d *dashboard) getManagedGuilds(guilds []domain.DiscordOAuthGuild) []domain.DiscordOAuthGuild {
+	managed := []domain.DiscordOAuthGuild{}
+	for _, guild := range guilds {
+		canManage := guild.Owner || guild.Permissions&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0
+		if _, err := d.dcSession.State.Guild(guild.Id); canManage && err == nil {
+			managed = append(managed, guild)
+		}
+	}
+	return managed
+}
+
+func (d *dashboard) getRedirectUrl() string {
+	return strings.TrimSuffix(d.configStore.Get().Dashboard.PublicUrl, "/") + "/callback"
+}
+
+// setCookie sets an HttpOnly cookie, Secure when the dashboard is served over HTTPS, a negative maxAge deletes it
+func (d *dashboard) setCookie(w http.ResponseWriter, name string, value string, maxAge time.Duration) {
+	cookieMaxAge := int(maxAge.Seconds())
+	if maxAge < 0 {
+		cookieMaxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   cookieMaxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(d.configStore.Get().Dashboard.PublicUrl, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func newDashboardToken() string {
+	token := make([]byte, 32)
+	_, _ = rand.Read(token)
+	return hex.EncodeToString(token)
+}
@@ -0,0 +1,218 @@
+"use strict";
+
+const $ = (selector, parent = document) => parent.querySelector(selector);
+
+let guild = null; // Guild shown, see domain.DashboardGuild
+
+async function request(method, path, body) {
+    const response = await fetch(path, {
+        method,
+        headers: body === undefined ? {} : {"Content-Type": "application/json"},
+        body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (response.status === 204) {
+        return null;
+    }
+    const result = await response.json();
+    if (!response.ok) {
+        const error = new Error(result.error || response.statusText);
+        error.status = response.status;
+        throw error;
+    }
+    return result;
+}
+
+function showError(error) {
+    $("#error").textContent = error ? error.message : "";
+    $("#error").hidden = !error;
+}
+
+function element(tag, text, className) {
+    const node = document.createElement(tag);
+    if (text !== undefined) {
+        node.textContent = text;
+    }
+    if (className) {
+        node.className = className;
+    }
+    return node;
+}
+
+function option(value, label, selected) {
+    const node = element("option", label);
+    node.value = value;
+    node.selected = value === selected;
+    return node;
+}
+
+function formatDate(date) {
+    return date ? new Date(date).toLocaleString() : "";
+}
+
+function streamerName(twitchId) {
+    const notifier = guild.notifiers.find(notifier => notifier.twitchId === twitchId);
+    return notifier && notifier.twitchName ? notifier.twitchName : twitchId;
+}
+
+function channelName(channelId) {
+    const channel = guild.channels.find(channel => channel.id === channelId);
+    return channel ? "#" + channel.name : channelId;
+}
+
+function row(cells) {
+    const tr = element("tr");
+    cells.forEach(cell => tr.append(element("td", cell)));
+    return tr;
+}
+
+function readSettings(form) {
+    return {
+        channelId: form.elements.channelId.value,
+        roleMentionId: form.elements.roleMentionId.value,
+        lang: form.elements.lang.value,
+        message: form.elements.message.checked,
+        buttons: form.elements.buttons.checked,
+        event: form.elements.event.checked,
+    };
+}
+
+// renderEmbed approximates the Discord rendering of a discordgo.MessageEmbed
+function renderEmbed(label, embed) {
+    const card = element("div", undefined, "embed");
+    card.style.borderColor = "#" + embed.color.toString(16).padStart(6, "0");
+    card.append(element("small", label));
+    if (embed.thumbnail) {
+        const thumbnail = element("img", undefined, "thumbnail");
+        thumbnail.src = embed.thumbnail.url;
+        thumbnail.alt = "";
+        card.append(thumbnail);
+    }
+    const title = element("a", embed.title, "title");
+    title.href = embed.url;
+    title.target = "_blank";
+    card.append(title, element("p", embed.description));
+    (embed.fields || []).forEach(field => {
+        const node = element("div", undefined, field.inline ? "field inline" : "field");
+        node.append(element("strong", field.name), element("span", field.value));
+        card.append(node);
+    });
+    if (embed.image) {
+        const image = element("img", undefined, "image");
+        image.src = embed.image.url;
+        image.alt = "";
+        card.append(image);
+    }
+    if (embed.footer) {
+        card.append(element("footer", embed.footer.text));
+    }
+    return card;
+}
+
+function renderNotifier(notifier) {
+    const form = $("#notifier-template").content.firstElementChild.cloneNode(true);
+    const settings = notifier.settings;
+    $(".name", form).textContent = notifier.twitchName || notifier.twitchId;
+    $(".source", form).textContent = notifier.source === "config" ? "config.yaml, edit it in the file" : "added from Discord";
+    $("button[type=submit]", form).disabled = notifier.source === "config";
+
+    const channels = form.elements.channelId;
+    channels.append(option("", "None", settings.channelId));
+    guild.channels.forEach(channel => channels.append(option(channel.id, "#" + channel.name, settings.channelId)));
+
+    const roles = form.elements.roleMentionId;
+    roles.append(option("", "No mention", settings.roleMentionId));
+    roles.append(option("everyone", "@everyone", settings.roleMentionId));
+    roles.append(option("here", "@here", settings.roleMentionId));
+    guild.roles.forEach(role => roles.append(option(role.id, "@" + role.name, settings.roleMentionId)));
+
+    guild.langs.forEach(lang => form.elements.lang.append(option(lang, lang, settings.lang)));
+    form.elements.message.checked = settings.message;
+    form.elements.buttons.checked = settings.buttons;
+    form.elements.event.checked = settings.event;
+
+    const path = `api/guilds/${guild.id}/notifiers/${notifier.twitchId}`;
+    const status = $(".status", form);
+    $(".preview", form).addEventListener("click", async () => {
+        try {
+            const previews = await request("POST", path + "/preview", readSettings(form));
+            $(".previews", form).replaceChildren(renderEmbed("Online", previews.online), renderEmbed("Offline", previews.offline));
+            status.textContent = "";
+        } catch (error) {
+            status.textContent = error.message;
+        }
+    });
+    form.addEventListener("submit", async event => {
+        event.preventDefault();
+        try {
+            await request("PUT", path, readSettings(form));
+            status.textContent = "Saved";
+        } catch (error) {
+            status.textContent = error.message;
+        }
+    });
+    return form;
+}
+
+function renderGuild() {
+    const live = guild.notifiers.filter(notifier => notifier.online);
+    $("#live").replaceChildren(...(live.length === 0
+        ? [element("li", "Nobody is live")]
+        : live.map(notifier => element("li", `${notifier.twitchName || notifier.twitchId}: ${notifier.streamTitle} (${notifier.gameName})`))));
+
+    $("#notifiers").replaceChildren(...guild.notifiers.map(renderNotifier));
+
+    const sessions = Object.entries(guild.sessions)
+        .flatMap(([twitchId, sessions]) => sessions.map(session => ({twitchId, ...session})))
+        .sort((a, b) => new Date(b.startedAt) - new Date(a.startedAt));
+    $("#sessions").replaceChildren(...sessions.map(session => row([
+        streamerName(session.twitchId), formatDate(session.startedAt), session.endedAt ? formatDate(session.endedAt) : "Live",
+        session.streamType, session.title, session.gameName,
+    ])));
+
+    $("#notifications").replaceChildren(...guild.notifications.map(record => row([
+        formatDate(record.time), streamerName(record.twitchId), channelName(record.channelId), record.action, record.mention ? "Yes" : "No",
+    ])));
+    $("#guild").hidden = false;
+}
+
+async function loadGuild(guildId) {
+    try {
+        guild = await request("GET", `api/guilds/${guildId}`);
+        showError(null);
+        renderGuild();
+    } catch (error) {
+        $("#guild").hidden = true;
+        showError(error);
+    }
+}
+
+async function init() {
+    let user;
+    try {
+        user = await request("GET", "api/me");
+    } catch (error) {
+        if (error.status !== 401) {
+            showError(error);
+        }
+        $("#login").hidden = false;
+        return;
+    }
+
+    $("#username").textContent = user.username;
+    $("#user").hidden = false;
+    $("#logout").addEventListener("click", async () => {
+        await request("POST", "logout", {});
+        location.reload();
+    });
+
+    if (user.guilds.length === 0) {
+        showError(new Error("No server with LiveStatus where you have the Manage Server permission"));
+        return;
+    }
+    const guilds = $("#guilds");
+    user.guilds.forEach(guild => guilds.append(option(guild.id, guild.name)));
+    guilds.addEventListener("change", () => loadGuild(guilds.value));
+    await loadGuild(guilds.value);
+}
+
+init();
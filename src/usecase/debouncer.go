@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// debouncer runs an update by key after a delay, a key scheduled again before its update runs is coalesced. The timers
+// and the running updates are tracked so they can be stopped on shutdown.
+type debouncer struct {
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	running sync.WaitGroup
+	ctx     context.Context // Cancelled on shutdown, no update is scheduled or started after
+	cancel  context.CancelFunc
+}
+
+func newDebouncer() *debouncer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &debouncer{
+		timers: make(map[string]*time.Timer),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// schedule runs the update of the key after the delay, unless it is already scheduled. The update gets the context
+// cancelled on shutdown.
+func (d *debouncer) schedule(key string, delay time.Duration, update func(ctx context.Context)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timers[key] != nil || d.ctx.Err() != nil {
+		return
+	}
+
+	d.timers[key] = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		delete(d.timers, key)
+		if d.ctx.Err() != nil {
+			d.mu.Unlock()
+			return
+		}
+		d.running.Add(1)
+		d.mu.Unlock()
+
+		defer d.running.Done()
+		update(d.ctx)
+	})
+}
+
+// shutdown stops the scheduled updates and waits for the running ones
+func (d *debouncer) shutdown(ctx context.Context) error {
+	d.cancel()
+	d.mu.Lock()
+	for key, timer := range d.timers {
+		timer.Stop()
+		delete(d.timers, key)
+	}
+	d.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("debounced updates not stopped: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"fmt"
+)
+
+// Diagnostics checks that every notifier can be delivered (guild, channel, permissions, role) and that Twitch can reach the webhook
+type Diagnostics interface {
+	Run() domain.ConfigProblems
+	RunGuild(guildId string) domain.ConfigProblems
+	Describe(problem domain.ConfigProblem) string
+}
+
+func NewDiagnostics(configStore internal.ConfigStore, checker ConfigChecker) Diagnostics {
+	return &diagnostics{
+		configStore: configStore,
+		checker:     checker,
+	}
+}
+
+type diagnostics struct {
+	configStore internal.ConfigStore
+	checker     ConfigChecker
+}
+
+// Run checks every notifier and the webhook then logs the report
+func (d *diagnostics) Run() domain.ConfigProblems {
+	config := d.configStore.Get()
+	problems := append(d.checker.CheckWebhook(config.Twitch), d.checker.CheckDiscord(*config)...)
+
+	if len(problems) == 0 {
+		internal.DiscordLog.Info("Diagnostics: no problem found", "servers", len(config.Discord.Servers))
+		return problems
+	}
+
+	internal.DiscordLog.Warn("Diagnostics: problems found", "count", len(problems))
+	for _, problem := range problems {
+		attrs := []any{"path", problem.Path, "problem", problem.Message}
+		if guildId, notifier := config.FindNotifierByPath(problem.Path); notifier != nil {
+			attrs = append(attrs, "guildId", guildId, "twitchId", notifier.TwitchId)
+		}
+		internal.DiscordLog.Warn("Diagnostics problem", attrs...)
+	}
+	return problems
+}
+
+// RunGuild checks the notifiers of a guild and the webhook, used for the on demand report of the admin command
+func (d *diagnostics) RunGuild(guildId string) domain.ConfigProblems {
+	config := d.configStore.Get()
+	return append(d.checker.CheckWebhook(config.Twitch), d.checker.CheckGuild(guildId, config.Discord.Servers[guildId])...)
+}
+
+// Describe formats a problem with the guild and the streamer of its notifier, the config path is meaningless for notifiers stored in database
+func (d *diagnostics) Describe(problem domain.ConfigProblem) string {
+	config := d.configStore.Get()
+	guildId, notifier := config.FindNotifierByPath(problem.Path)
+	if notifier == nil {
+		if guildId != "" {
+			return fmt.Sprintf("(guildId=%s) %s", guildId, problem.Message)
+		}
+		return fmt.Sprintf("%s: %s", problem.Path, problem.Message)
+	}
+
+	name := notifier.TwitchId
+	if userResolver, ok := config.Twitch.UserResolver[notifier.TwitchId]; ok {
+		name = userResolver.TwitchName
+	}
+	return fmt.Sprintf("(guildId=%s, streamer=%s) %s", guildId, name, problem.Message)
+}
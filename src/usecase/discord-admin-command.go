@@ -0,0 +1,429 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"strconv"
+	"strings"
+)
+
+type DiscordAdminCommand interface {
+	InitCommands() error
+	RegisterCommands() error
+}
+
+func NewDiscordAdminCommand(configStore internal.ConfigStore, configUpdater ConfigUpdater, diagnostics Diagnostics, twClient internal.TwitchClient, dcSession *discordgo.Session, i18n internal.I18n) DiscordAdminCommand {
+	return &discordAdminCommand{
+		configStore:   configStore,
+		configUpdater: configUpdater,
+		diagnostics:   diagnostics,
+		twClient:      twClient,
+		dcSession:     dcSession,
+		i18n:          i18n,
+	}
+}
+
+type discordAdminCommand struct {
+	configStore   internal.ConfigStore
+	configUpdater ConfigUpdater
+	diagnostics   Diagnostics
+	twClient      internal.TwitchClient
+	dcSession     *discordgo.Session
+	i18n          internal.I18n
+}
+
+// InitCommands registers the admin command globally, so a guild without notifier can add its first one
+func (d *discordAdminCommand) InitCommands() error {
+	d.dcSession.AddHandler(d.adminCommandHandler)
+	return d.RegisterCommands()
+}
+
+// RegisterCommands creates or replaces the global admin command
+func (d *discordAdminCommand) RegisterCommands() error {
+	_, err := d.dcSession.ApplicationCommandCreate(d.dcSession.State.User.ID, "", d.getCommand())
+	return err
+}
+
+func (d *discordAdminCommand) getCommand() *discordgo.ApplicationCommand {
+	i18nMessages := d.i18n.GetMessages(domain.I18nDefaultLang).Discord.AdminCommand
+	describe := func(descriptions map[string]string, name string) string {
+		if description, ok := descriptions[name]; ok && description != "" {
+			return description
+		}
+		return name
+	}
+
+	manageServer := int64(discordgo.PermissionManageServer)
+	dmPermission := false
+
+	var langChoices []*discordgo.ApplicationCommandOptionChoice
+	for _, lang := range d.i18n.GetLangs() {
+		if len(langChoices) < domain.AdminCommandMaxChoices {
+			langChoices = append(langChoices, &discordgo.ApplicationCommandOptionChoice{Name: lang, Value: lang})
+		}
+	}
+
+	streamerOption := func() *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Name:        domain.AdminOptionStreamer,
+			Description: describe(i18nMessages.Options, domain.AdminOptionStreamer),
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+		}
+	}
+	notifierOptions := func(channelRequired bool) []*discordgo.ApplicationCommandOption {
+		return []*discordgo.ApplicationCommandOption{
+			streamerOption(),
+			{
+				Name:         domain.AdminOptionChannel,
+				Description:  describe(i18nMessages.Options, domain.AdminOptionChannel),
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				ChannelTypes: announcementChannelTypes,
+				Required:     channelRequired,
+			},
+			{
+				Name:        domain.AdminOptionRole,
+				Description: describe(i18nMessages.Options, domain.AdminOptionRole),
+				Type:        discordgo.ApplicationCommandOptionRole,
+			},
+			{
+				Name:        domain.AdminOptionLang,
+				Description: describe(i18nMessages.Options, domain.AdminOptionLang),
+				Type:        discordgo.ApplicationCommandOptionString,
+				Choices:     langChoices,
+			},
+			{
+				Name:        domain.AdminOptionButtons,
+				Description: describe(i18nMessages.Options, domain.AdminOptionButtons),
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+			},
+			{
+				Name:        domain.AdminOptionEvent,
+				Description: describe(i18nMessages.Options, domain.AdminOptionEvent),
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+			},
+		}
+	}
+
+	setOptions := append(notifierOptions(false),
+		&discordgo.ApplicationCommandOption{
+			Name:        domain.AdminOptionClearRole,
+			Description: describe(i18nMessages.Options, domain.AdminOptionClearRole),
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+		},
+		&discordgo.ApplicationCommandOption{
+			Name:        domain.AdminOptionMessage,
+			Description: describe(i18nMessages.Options, domain.AdminOptionMessage),
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+		},
+	)
+
+	return &discordgo.ApplicationCommand{
+		Name:                     domain.AdminCommandName,
+		Type:                     discordgo.ChatApplicationCommand,
+		Description:              i18nMessages.Description,
+		DefaultMemberPermissions: &manageServer,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        domain.AdminSubcommandAdd,
+				Description: describe(i18nMessages.Subcommands, domain.AdminSubcommandAdd),
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     notifierOptions(true),
+			},
+			{
+				Name:        domain.AdminSubcommandRemove,
+				Description: describe(i18nMessages.Subcommands, domain.AdminSubcommandRemove),
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     []*discordgo.ApplicationCommandOption{streamerOption()},
+			},
+			{
+				Name:        domain.AdminSubcommandList,
+				Description: describe(i18nMessages.Subcommands, domain.AdminSubcommandList),
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+			},
+			{
+				Name:        domain.AdminSubcommandSet,
+				Description: describe(i18nMessages.Subcommands, domain.AdminSubcommandSet),
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options:     setOptions,
+			},
+			{
+				Name:        domain.AdminSubcommandCheck,
+				Description: describe(i18nMessages.Subcommands, domain.AdminSubcommandCheck),
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+			},
+		},
+	}
+}
+
+func (d *discordAdminCommand) adminCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand || i.ApplicationCommandData().Name != domain.AdminCommandName {
+		return
+	}
+	if i.GuildID == "" || i.Member == nil {
+		return // Must never happen, the command is disabled in DM
+	}
+
+	i18nMessages := d.i18n.GetMessages(d.configStore.Get().Discord.GetGuildLang(i.GuildID)).Discord.AdminCommand
+	respond := func(content string) {
+		_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags:   discordgo.MessageFlagsEphemeral,
+				Content: content,
+			},
+		})
+	}
+
+	// DefaultMemberPermissions can be overridden by guild admins, check again
+	if i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		respond(i18nMessages.Forbidden)
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return // Must never happen, a subcommand is required
+	}
+	subcommand := options[0]
+	optionsByName := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, option := range subcommand.Options {
+		optionsByName[option.Name] = option
+	}
+
+	if subcommand.Name == domain.AdminSubcommandList {
+		respond(d.handleList(i.GuildID, i18nMessages))
+		return
+	}
+
+	// Twitch and Discord calls can exceed the 3 seconds to answer an interaction
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		internal.DiscordLog.Error("adminCommandHandler InteractionRespond failed", "guildId", i.GuildID, "error", err)
+		return
+	}
+
+	var content string
+	switch subcommand.Name {
+	case domain.AdminSubcommandAdd:
+		content = d.handleAdd(i.GuildID, optionsByName, i18nMessages)
+	case domain.AdminSubcommandRemove:
+		content = d.handleRemove(i.GuildID, optionsByName, i18nMessages)
+	case domain.AdminSubcommandSet:
+		content = d.handleSet(i.GuildID, optionsByName, i18nMessages)
+	case domain.AdminSubcommandCheck:
+		content = d.handleCheck(i.GuildID, i18nMessages)
+	}
+
+	if _, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+		internal.DiscordLog.Error("adminCommandHandler InteractionResponseEdit failed", "guildId", i.GuildID, "error", err)
+	}
+}
+
+func (d *discordAdminCommand) handleAdd(guildId string, options map[string]*discordgo.ApplicationCommandInteractionDataOption, i18nMessages domain.DiscordAdminCommandI18n) string {
+	streamer := options[domain.AdminOptionStreamer].StringValue()
+	twitchUser, err := d.resolveTwitchUser(streamer)
+	if err != nil {
+		return d.formatError(i18nMessages, err)
+	} else if twitchUser == nil {
+		return d.i18n.Format(i18nMessages.StreamerNotFound, map[string]string{"%streamer%": streamer})
+	}
+	// SetNotifier replaces the notifier, the settings missing from the options (rules, thread...) would be lost
+	if d.findGuildNotifier(guildId, twitchUser.ID) != nil {
+		return d.i18n.Format(i18nMessages.NotifierExists, map[string]string{"%streamer%": twitchUser.DisplayName})
+	}
+
+	notifier := domain.DiscordNotifier{
+		TwitchId: twitchUser.ID,
+		Lang:     d.configStore.Get().Discord.GetGuildLang(guildId),
+	}
+	notifier.Message.Active = true
+	notifier.Message.Buttons = true
+	d.applyOptions(guildId, &notifier, options)
+
+	if err = d.configUpdater.SetNotifier(guildId, notifier); err != nil {
+		return d.formatError(i18nMessages, err)
+	}
+
+	return d.i18n.Format(i18nMessages.Added, map[string]string{
+		"%streamer%": twitchUser.DisplayName,
+		"%channel%":  fmt.Sprintf("<#%s>", notifier.Message.ChannelId),
+	})
+}
+
+func (d *discordAdminCommand) handleRemove(guildId string, options map[string]*discordgo.ApplicationCommandInteractionDataOption, i18nMessages domain.DiscordAdminCommandI18n) string {
+	streamer := options[domain.AdminOptionStreamer].StringValue()
+	variables := map[string]string{"%streamer%": streamer}
+
+	notifier := d.findGuildNotifier(guildId, streamer)
+	if notifier == nil {
+		return d.i18n.Format(i18nMessages.NotifierNotFound, variables)
+	}
+
+	err := d.configUpdater.RemoveNotifier(guildId, notifier.TwitchId)
+	switch {
+	case errors.Is(err, domain.ErrNotifierInConfigFile):
+		return d.i18n.Format(i18nMessages.NotifierInConfig, variables)
+	case errors.Is(err, domain.ErrNotifierNotFound):
+		return d.i18n.Format(i18nMessages.NotifierNotFound, variables)
+	case err != nil:
+		return d.formatError(i18nMessages, err)
+	}
+
+	return d.i18n.Format(i18nMessages.Removed, variables)
+}
+
+func (d *discordAdminCommand) handleSet(guildId string, options map[string]*discordgo.ApplicationCommandInteractionDataOption, i18nMessages domain.DiscordAdminCommandI18n) string {
+	streamer := options[domain.AdminOptionStreamer].StringValue()
+	variables := map[string]string{"%streamer%": streamer}
+
+	notifier := d.findGuildNotifier(guildId, streamer)
+	if notifier == nil {
+		return d.i18n.Format(i18nMessages.NotifierNotFound, variables)
+	}
+
+	d.applyOptions(guildId, notifier, options)
+	if option, ok := options[domain.AdminOptionClearRole]; ok && option.BoolValue() {
+		notifier.Message.RoleMentionId = ""
+	}
+	if option, ok := options[domain.AdminOptionMessage]; ok {
+		notifier.Message.Active = option.BoolValue()
+	}
+
+	err := d.configUpdater.SetNotifier(guildId, *notifier)
+	if errors.Is(err, domain.ErrNotifierInConfigFile) {
+		return d.i18n.Format(i18nMessages.NotifierInConfig, variables)
+	} else if err != nil {
+		return d.formatError(i18nMessages, err)
+	}
+
+	return d.i18n.Format(i18nMessages.Updated, variables)
+}
+
+func (d *discordAdminCommand) handleList(guildId string, i18nMessages domain.DiscordAdminCommandI18n) string {
+	config := d.configStore.Get()
+	notifiers := config.Discord.Servers[guildId]
+	if len(notifiers) == 0 {
+		return i18nMessages.ListEmpty
+	}
+
+	onOff := func(value bool) string {
+		if value {
+			return "✅"
+		}
+		return "❌"
+	}
+
+	// The lines past the message length are counted in a last line, room is kept for the largest count
+	content := i18nMessages.List
+	more := "\n" + d.i18n.Format(i18nMessages.ListMore, map[string]string{"%count%": strconv.Itoa(len(notifiers))})
+	for index, notifier := range notifiers {
+		name := notifier.TwitchId
+		if userResolver, ok := config.Twitch.UserResolver[notifier.TwitchId]; ok {
+			name = userResolver.TwitchDisplayName
+		}
+
+		source := "discord"
+		if d.configUpdater.IsFileNotifier(guildId, notifier.TwitchId) {
+			source = "config"
+		}
+
+		mention := "-"
+		if notifier.Message.RoleMentionId != "" {
+			mention = getRoleMention(notifier.Message.RoleMentionId)
+		}
+
+		line := fmt.Sprintf("\n- **%s** (`%s`) <#%s> %s `%s` message %s buttons %s event %s *(%s)*",
+			name, notifier.TwitchId, notifier.Message.ChannelId, mention, notifier.Lang,
+			onOff(notifier.Message.Active), onOff(notifier.Message.Buttons), onOff(notifier.Event.Active), source)
+		if len(content)+len(line)+len(more) > domain.MessageMaxLength {
+			return content + "\n" + d.i18n.Format(i18nMessages.ListMore, map[string]string{"%count%": strconv.Itoa(len(notifiers) - index)})
+		}
+		content += line
+	}
+	return content
+}
+
+func (d *discordAdminCommand) handleCheck(guildId string, i18nMessages domain.DiscordAdminCommandI18n) string {
+	problems := d.diagnostics.RunGuild(guildId)
+	if len(problems) == 0 {
+		return i18nMessages.CheckOk
+	}
+
+	content := d.i18n.Format(i18nMessages.CheckProblems, map[string]string{"%count%": strconv.Itoa(len(problems))})
+	for _, problem := range problems {
+		line := "\n- " + d.diagnostics.Describe(problem)
+		if len(content)+len(line) > domain.MessageMaxLength {
+			break
+		}
+		content += line
+	}
+	return content
+}
+
+func (d *discordAdminCommand) applyOptions(guildId string, notifier *domain.DiscordNotifier, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	if option, ok := options[domain.AdminOptionChannel]; ok {
+		notifier.Message.ChannelId = option.ChannelValue(nil).ID
+	}
+	if option, ok := options[domain.AdminOptionRole]; ok {
+		roleId := option.RoleValue(nil, guildId).ID
+		if roleId == guildId {
+			roleId = domain.EveryoneMention // @everyone role has the guild id
+		}
+		notifier.Message.RoleMentionId = roleId
+	}
+	if option, ok := options[domain.AdminOptionLang]; ok {
+		notifier.Lang = option.StringValue()
+	}
+	if option, ok := options[domain.AdminOptionButtons]; ok {
+		notifier.Message.Buttons = option.BoolValue()
+	}
+	if option, ok := options[domain.AdminOptionEvent]; ok {
+		notifier.Event.Active = option.BoolValue()
+	}
+}
+
+// resolveTwitchUser finds a Twitch user by login, or by id as fallback when the input is numeric
+func (d *discordAdminCommand) resolveTwitchUser(streamer string) (*domain.TwitchUserResponse, error) {
+	streamer = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(streamer)), "@")
+	users, err := d.twClient.GetTwitchUsersByLogin([]string{streamer})
+	if err != nil {
+		return nil, err
+	}
+	// Helix rejects an id that is not numeric, a login typo must end as not found
+	if len(users) == 0 && streamer != "" && strings.Trim(streamer, "0123456789") == "" {
+		if users, err = d.twClient.GetTwitchUsers([]string{streamer}); err != nil {
+			return nil, err
+		}
+	}
+	for _, user := range users {
+		return &user, nil
+	}
+	return nil, nil
+}
+
+// findGuildNotifier returns a copy of the guild notifier matching the streamer login, display name or id
+func (d *discordAdminCommand) findGuildNotifier(guildId string, streamer string) *domain.DiscordNotifier {
+	config := d.configStore.Get()
+	for _, notifier := range config.Discord.Servers[guildId] {
+		userResolver := config.Twitch.UserResolver[notifier.TwitchId]
+		if notifier.TwitchId == streamer || strings.EqualFold(userResolver.TwitchName, streamer) || strings.EqualFold(userResolver.TwitchDisplayName, streamer) {
+			return &notifier
+		}
+	}
+	return nil
+}
+
+func (d *discordAdminCommand) formatError(i18nMessages domain.DiscordAdminCommandI18n, err error) string {
+	internal.DiscordLog.Error("adminCommandHandler failed", "error", err)
+	return d.i18n.Format(i18nMessages.AppError, map[string]string{"%error%": err.Error()})
+}
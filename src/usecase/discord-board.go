@@ -0,0 +1,201 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/avast/retry-go/v4"
+	"github.com/bwmarrin/discordgo"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type DiscordBoard interface {
+	HandleLiveState(state domain.LiveState)
+	Shutdown(ctx context.Context) error
+}
+
+func NewDiscordBoard(dcInstance *discordgo.Session, configStore internal.ConfigStore, database internal.Database, mapTwitchIdsToState *domain.LiveStates, i18n internal.I18n, metrics *internal.Metrics) DiscordBoard {
+	return &discordBoard{
+		dcInstance:          dcInstance,
+		configStore:         configStore,
+		database:            database,
+		mapTwitchIdsToState: mapTwitchIdsToState,
+		i18n:                i18n,
+		metrics:             metrics,
+		debouncer:           newDebouncer(),
+	}
+}
+
+type discordBoard struct {
+	dcInstance          *discordgo.Session
+	configStore         internal.ConfigStore
+	database            internal.Database
+	mapTwitchIdsToState *domain.LiveStates
+	i18n                internal.I18n
+	metrics             *internal.Metrics
+
+	debouncer *debouncer // Guild ids as keys
+	updateMu  sync.Mutex // One update at a time, a slow edit must not lead to a second board message
+}
+
+// HandleLiveState schedules the update of the boards listing the streamer, the changes within domain.BoardDebounceDelay
+// are grouped in a single edit built from the live states at that time. The update is retried and logged on its own.
+func (b *discordBoard) HandleLiveState(state domain.LiveState) {
+	config := b.configStore.Get()
+	for guildId := range config.Discord.Boards {
+		isListed := slices.ContainsFunc(config.Discord.Servers[guildId], func(notifier domain.DiscordNotifier) bool {
+			return notifier.TwitchId == state.TwitchId
+		})
+		if isListed {
+			b.debouncer.schedule(guildId, domain.BoardDebounceDelay, func(ctx context.Context) {
+				err := retry.Do(func() error {
+					return b.update(guildId)
+				}, retry.Context(ctx), retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay))
+				if err != nil {
+					internal.DiscordLog.Error("Failed to update the board", "guildId", guildId, "error", err)
+				}
+			})
+		}
+	}
+}
+
+// Shutdown stops the scheduled updates and waits for the running ones, the boards are updated again after the restart
+func (b *discordBoard) Shutdown(ctx context.Context) error {
+	return b.debouncer.shutdown(ctx)
+}
+
+// update edits the board message of the guild, a new one is posted when it was deleted or the channel changed
+func (b *discordBoard) update(guildId string) error {
+	b.updateMu.Lock()
+	defer b.updateMu.Unlock()
+
+	config := b.configStore.Get()
+	board, ok := config.Discord.Boards[guildId]
+	if !ok {
+		return nil
+	}
+
+	embed := b.getBoardEmbed(board.Lang, config.Discord.Servers[guildId])
+	dbMessage, err := b.database.GetBoardMessage(guildId)
+	if err != nil {
+		return fmt.Errorf("failed to get the board message of guild %s: %w", guildId, err)
+	}
+
+	if dbMessage.MessageId != "" && dbMessage.ChannelId == board.ChannelId {
+		_, err = b.dcInstance.ChannelMessageEditEmbed(board.ChannelId, dbMessage.MessageId, embed)
+		if err == nil {
+			b.metrics.DiscordMessages.Inc(internal.MetricsActionEdited)
+			return nil
+		}
+		if !isDiscordNotFound(err) {
+			return fmt.Errorf("failed to edit the board message %s in guild %s: %w", dbMessage.MessageId, guildId, err)
+		}
+	} else if dbMessage.MessageId != "" {
+		// The board moved, the old message is removed on a best effort basis
+		if err = b.dcInstance.ChannelMessageDelete(dbMessage.ChannelId, dbMessage.MessageId); err != nil && !isDiscordNotFound(err) {
+			internal.DiscordLog.Warn("Failed to delete the previous board message", "guildId", guildId, "channelId", dbMessage.ChannelId, "messageId", dbMessage.MessageId, "error", err)
+		}
+	}
+
+	message, err := b.dcInstance.ChannelMessageSendEmbed(board.ChannelId, embed)
+	if err != nil {
+		return fmt.Errorf("failed to send the board message to channel %s in guild %s: %w", board.ChannelId, guildId, err)
+	}
+	b.metrics.DiscordMessages.Inc(internal.MetricsActionCreated)
+
+	return b.database.SetBoardMessage(guildId, domain.DiscordBoardMessage{ChannelId: board.ChannelId, MessageId: message.ID})
+}
+
+// getBoardEmbed lists the live streamers of the notifiers sorted by viewers, each entry is named with the online
+// embed title of the stream so the board reads like the announcements. The entries that do not fit in the embed are
+// counted in the footer.
+func (b *discordBoard) getBoardEmbed(lang string, notifiers []domain.DiscordNotifier) *discordgo.MessageEmbed {
+	i18nMessages := b.i18n.GetMessages(lang).Discord
+	entries := getLiveStreams(b.mapTwitchIdsToState, notifiers)
+	slices.SortStableFunc(entries, func(first, second liveStream) int {
+		return cmp.Compare(second.state.OnlineState.ViewerCount, first.state.OnlineState.ViewerCount)
+	})
+
+	color := domain.EmbedColorOnline
+	title := b.i18n.Format(i18nMessages.Board.Title, map[string]string{"%count%": strconv.Itoa(len(entries))})
+	if len(entries) == 0 {
+		color = domain.EmbedColorOffline
+		title = i18nMessages.Board.Empty
+	}
+	command := fmt.Sprintf("/%s", domain.LiveCommandName)
+
+	// The footer is counted with the largest count of left out entries it can show
+	maxFooter := fmt.Sprintf("%s · %s", b.i18n.Format(i18nMessages.Board.More, map[string]string{"%count%": strconv.Itoa(len(entries))}), command)
+	budget := domain.EmbedMaxLength - utf8.RuneCountInString(title) - utf8.RuneCountInString(maxFooter)
+
+	var fields []*discordgo.MessageEmbedField
+	for _, entry := range entries[:min(len(entries), domain.BoardMaxEntries)] {
+		streamVariables := entry.state.GetStreamVariables("R")
+		streamVariables["%viewers%"] = strconv.Itoa(entry.state.OnlineState.ViewerCount)
+		streamVariables["%uptime%"] = formatStreamDuration(time.Since(entry.state.OnlineState.StartedAt))
+		name := truncateText(b.i18n.Format(i18nMessages.Embed.GetOnline(entry.template).Title, streamVariables), domain.EmbedFieldNameMaxLength)
+		value := truncateText(fmt.Sprintf("%s\n%s", b.i18n.Format(i18nMessages.Board.Entry, streamVariables), entry.state.LiveUrl()), domain.EmbedFieldValueMaxLength)
+
+		length := utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+		if length > budget {
+			break
+		}
+		budget -= length
+		fields = append(fields, &discordgo.MessageEmbedField{Name: name, Value: value})
+	}
+
+	footer := command
+	if left := len(entries) - len(fields); left > 0 {
+		footer = fmt.Sprintf("%s · %s", b.i18n.Format(i18nMessages.Board.More, map[string]string{"%count%": strconv.Itoa(left)}), command)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:  title,
+		Type:   discordgo.EmbedTypeRich,
+		Color:  color,
+		Fields: fields,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text:    footer,
+			IconURL: domain.EmbedFooterIconUrl,
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+}
+
+// truncateText cuts the text to maxLength characters, the last one becoming an ellipsis
+func truncateText(text string, maxLength int) string {
+	if runes := []rune(text); len(runes) > maxLength {
+		return string(runes[:maxLength-1]) + "…"
+	}
+	return text
+}
+
+// liveStream is the live state of a streamer as seen by one of its notifiers
+type liveStream struct {
+	state    domain.LiveState
+	template string // Template of the stream type rule
+}
+
+// getLiveStreams returns the streamers of the notifiers that are live and not silenced by their rules
+func getLiveStreams(mapTwitchIdsToState *domain.LiveStates, notifiers []domain.DiscordNotifier) []liveStream {
+	var streams []liveStream
+	for _, notifier := range notifiers {
+		globalState, ok := mapTwitchIdsToState.Get(notifier.TwitchId)
+		if !ok || slices.ContainsFunc(streams, func(stream liveStream) bool { return stream.state.TwitchId == notifier.TwitchId }) {
+			continue
+		}
+
+		state := notifier.FilterLiveState(*globalState)
+		if state.IsOnline() && notifier.EvaluateRules(state) != domain.RuleActionSilent {
+			rule, _ := notifier.GetStreamTypeRule(state.OnlineState.Type)
+			streams = append(streams, liveStream{state: state, template: rule.Template})
+		}
+	}
+	return streams
+}
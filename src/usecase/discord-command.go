@@ -8,12 +8,13 @@ import (
 
 type DiscordCommand interface {
 	InitCommands() error
+	RegisterGuildCommands(guildIds []string) error
 	GetSession() *discordgo.Session
 }
 
-func NewDiscordCommand(config *domain.Config, mapTwitchIdsToState map[string]*domain.LiveState, dcSession *discordgo.Session, dcMessage DiscordMessage, i18n internal.I18n) DiscordCommand {
+func NewDiscordCommand(configStore internal.ConfigStore, mapTwitchIdsToState *domain.LiveStates, dcSession *discordgo.Session, dcMessage DiscordMessage, i18n internal.I18n) DiscordCommand {
 	return &discordCommand{
-		config:              config,
+		configStore:         configStore,
 		dcSession:           dcSession,
 		dcMessage:           dcMessage,
 		i18n:                i18n,
@@ -22,49 +23,38 @@ func NewDiscordCommand(config *domain.Config, mapTwitchIdsToState map[string]*do
 }
 
 type discordCommand struct {
-	config              *domain.Config
+	configStore         internal.ConfigStore
 	dcSession           *discordgo.Session
 	dcMessage           DiscordMessage
 	i18n                internal.I18n
-	mapTwitchIdsToState map[string]*domain.LiveState
+	mapTwitchIdsToState *domain.LiveStates
 }
 
 func (d *discordCommand) InitCommands() error {
 	d.dcSession.AddHandler(d.liveCommandHandler)
 
-	err := d.unregisterCommands()
-	if err != nil {
-		return err
+	var guildIds []string
+	for guildId := range d.configStore.Get().Discord.Servers {
+		guildIds = append(guildIds, guildId)
 	}
-
-	err = d.registerCommands()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return d.RegisterGuildCommands(guildIds)
 }
 
 func (d *discordCommand) GetSession() *discordgo.Session {
 	return d.dcSession
 }
 
-func (d *discordCommand) unregisterCommands() error {
-	twitchIdsGroupByServer := d.config.GetAllTwitchLinkGroupByGuild()
+// RegisterGuildCommands replaces the live command of the guilds, the command is only removed for guilds without streamer
+func (d *discordCommand) RegisterGuildCommands(guildIds []string) error {
+	guildToTwitchLink := d.configStore.Get().GetAllTwitchLinkGroupByGuild()
 
-	for guildId, _ := range twitchIdsGroupByServer {
-		applications, err := d.dcSession.ApplicationCommands(d.dcSession.State.User.ID, guildId)
-		if err != nil {
+	for _, guildId := range guildIds {
+		if err := d.unregisterCommand(guildId); err != nil {
 			return err
 		}
 
-		for _, application := range applications {
-			if application.Name != domain.LiveCommandName {
-				continue
-			}
-
-			err := d.dcSession.ApplicationCommandDelete(d.dcSession.State.User.ID, guildId, application.ID)
-			if err != nil {
+		if twitchLinks := guildToTwitchLink[guildId]; len(twitchLinks) > 0 {
+			if err := d.registerCommand(guildId, twitchLinks); err != nil {
 				return err
 			}
 		}
@@ -73,39 +63,18 @@ func (d *discordCommand) unregisterCommands() error {
 	return nil
 }
 
-func (d *discordCommand) registerCommands() error {
-	guildToTwitchLink := d.config.GetAllTwitchLinkGroupByGuild()
-
-	for guildId, twitchLinks := range guildToTwitchLink {
-		commandLang := domain.I18nDefaultLang
-		if notifiers, ok := d.config.Discord.Servers[guildId]; ok {
-			if len(notifiers) > 0 {
-				commandLang = notifiers[0].Lang
-			}
-		}
-		i18nMessages := d.i18n.GetMessages(commandLang)
-
-		liveCommand := discordgo.ApplicationCommand{
-			Name:        domain.LiveCommandName,
-			Type:        discordgo.ChatApplicationCommand,
-			Description: i18nMessages.Discord.LiveCommand.Description,
-		}
+func (d *discordCommand) unregisterCommand(guildId string) error {
+	applications, err := d.dcSession.ApplicationCommands(d.dcSession.State.User.ID, guildId)
+	if err != nil {
+		return err
+	}
 
-		liveCommand.Options = []*discordgo.ApplicationCommandOption{{
-			Name:        i18nMessages.Discord.LiveCommand.Option.Name,
-			Description: i18nMessages.Discord.LiveCommand.Option.Description,
-			Type:        discordgo.ApplicationCommandOptionString,
-			Required:    true,
-			Choices:     []*discordgo.ApplicationCommandOptionChoice{},
-		}}
-		for _, linkIdName := range twitchLinks {
-			liveCommand.Options[0].Choices = append(liveCommand.Options[0].Choices, &discordgo.ApplicationCommandOptionChoice{
-				Name:  linkIdName.TwitchDisplayName,
-				Value: linkIdName.TwitchId,
-			})
+	for _, application := range applications {
+		if application.Name != domain.LiveCommandName {
+			continue
 		}
 
-		_, err := d.dcSession.ApplicationCommandCreate(d.dcSession.State.User.ID, guildId, &liveCommand)
+		err := d.dcSession.ApplicationCommandDelete(d.dcSession.State.User.ID, guildId, application.ID)
 		if err != nil {
 			return err
 		}
@@ -114,29 +83,62 @@ func (d *discordCommand) registerCommands() error {
 	return nil
 }
 
+func (d *discordCommand) registerCommand(guildId string, twitchLinks []domain.TwitchUserResolver) error {
+	i18nMessages := d.i18n.GetMessages(d.configStore.Get().Discord.GetGuildLang(guildId))
+
+	liveCommand := discordgo.ApplicationCommand{
+		Name:        domain.LiveCommandName,
+		Type:        discordgo.ChatApplicationCommand,
+		Description: i18nMessages.Discord.LiveCommand.Description,
+	}
+
+	liveCommand.Options = []*discordgo.ApplicationCommandOption{{
+		Name:        i18nMessages.Discord.LiveCommand.Option.Name,
+		Description: i18nMessages.Discord.LiveCommand.Option.Description,
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    true,
+		Choices:     []*discordgo.ApplicationCommandOptionChoice{},
+	}}
+	for _, linkIdName := range twitchLinks {
+		liveCommand.Options[0].Choices = append(liveCommand.Options[0].Choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  linkIdName.TwitchDisplayName,
+			Value: linkIdName.TwitchId,
+		})
+	}
+
+	_, err := d.dcSession.ApplicationCommandCreate(d.dcSession.State.User.ID, guildId, &liveCommand)
+	return err
+}
+
 func (d *discordCommand) liveCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand || i.ApplicationCommandData().Name != domain.LiveCommandName {
+		return
+	}
+
 	options := i.ApplicationCommandData().Options
 	if len(options) == 0 {
 		return // Must never happen, option is required
 	}
 
 	twitchId := options[0].StringValue()
-	notifier := d.config.Discord.FindNotifierByGuildIdAndTwitchId(i.GuildID, twitchId)
+	notifier := d.configStore.Get().Discord.FindNotifierByGuildIdAndTwitchId(i.GuildID, twitchId)
 	if notifier == nil {
 		return // Must never happen
 	}
 
-	liveState, ok := d.mapTwitchIdsToState[twitchId]
+	liveState, ok := d.mapTwitchIdsToState.Get(twitchId)
 	if !ok {
 		return // Must never happen
 	}
 
+	state := notifier.FilterLiveState(*liveState)
+	rule, _ := notifier.GetStreamTypeRule(state.OnlineState.Type)
 	_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Flags:      discordgo.MessageFlagsEphemeral,
-			Components: d.dcMessage.getComponents(notifier.Lang, *liveState),
-			Embeds:     []*discordgo.MessageEmbed{d.dcMessage.getEmbed(notifier.Lang, *liveState)},
+			Components: d.dcMessage.getComponents(notifier.Lang, rule.Template, state),
+			Embeds:     []*discordgo.MessageEmbed{d.dcMessage.getEmbed(notifier.Lang, rule.Template, state)},
 		},
 	})
 }
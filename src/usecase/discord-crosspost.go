@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"sync"
+	"time"
+)
+
+// crosspostLimits remembers the announcement channels rate limited by Discord, their crossposts are skipped until
+// the limit resets instead of holding an outbox worker for up to an hour
+type crosspostLimits struct {
+	mu    sync.Mutex
+	until map[string]time.Time // channelId as key
+}
+
+func newCrosspostLimits() *crosspostLimits {
+	return &crosspostLimits{until: make(map[string]time.Time)}
+}
+
+func (l *crosspostLimits) isLimited(channelId string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.until[channelId])
+}
+
+func (l *crosspostLimits) limit(channelId string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.until[channelId] = time.Now().Add(retryAfter)
+}
+
+// crosspost publishes the first message of a stream to the servers following the announcement channel, its later edits
+// are propagated by Discord. A repost of the same stream is not published again. The message is already posted, the
+// failures are only logged
+func (m discordMessage) crosspost(guildId string, channelId string, state domain.LiveState, message *discordgo.Message) {
+	logger := internal.DiscordLog.With("guildId", guildId, "channelId", channelId, "messageId", message.ID)
+	channel, err := m.getChannel(channelId)
+	if err != nil {
+		logger.Warn("Failed to get the crossposted channel", "error", err)
+		return
+	} else if channel.Type != discordgo.ChannelTypeGuildNews {
+		logger.Warn("Crosspost skipped, the channel is not an announcement channel")
+		return
+	}
+
+	crosspostedAt, err := m.database.GetCrosspostedStream(state.TwitchId, channel.ID)
+	if err != nil {
+		logger.Warn("Failed to get the crossposted stream", "error", err)
+		return
+	} else if crosspostedAt.Equal(state.OnlineState.StartedAt) {
+		return
+	}
+	if m.crosspostLimits.isLimited(channel.ID) {
+		logger.Warn("Crosspost skipped, the channel is rate limited")
+		return
+	}
+
+	_, err = m.dcInstance.ChannelMessageCrosspost(channel.ID, message.ID, discordgo.WithRetryOnRatelimit(false))
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		m.crosspostLimits.limit(channel.ID, rateLimitErr.RetryAfter)
+		logger.Warn("Crosspost skipped, the channel is rate limited", "retryAfter", rateLimitErr.RetryAfter)
+		return
+	} else if err != nil {
+		logger.Warn("Failed to crosspost the message", "error", err)
+		return
+	}
+	m.metrics.DiscordMessages.Inc(internal.MetricsActionCrossposted)
+
+	if err = m.database.SetCrosspostedStream(state.TwitchId, channel.ID, state.OnlineState.StartedAt); err != nil {
+		logger.Warn("Failed to save the crossposted stream", "error", err)
+	}
+}
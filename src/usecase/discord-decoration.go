@@ -0,0 +1,213 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"cmp"
+	"context"
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	presenceKey         = "presence" // Debouncer keys of the presence, the counters use their guildId
+	presenceRotationKey = "presenceRotation"
+)
+
+type DiscordDecoration interface {
+	HandleLiveState(state domain.LiveState)
+	HandleReady()
+	Shutdown(ctx context.Context) error
+}
+
+func NewDiscordDecoration(dcInstance *discordgo.Session, configStore internal.ConfigStore, mapTwitchIdsToState *domain.LiveStates, i18n internal.I18n) DiscordDecoration {
+	return &discordDecoration{
+		dcInstance:          dcInstance,
+		configStore:         configStore,
+		mapTwitchIdsToState: mapTwitchIdsToState,
+		i18n:                i18n,
+		debouncer:           newDebouncer(),
+		renames:             make(map[string][]time.Time),
+		limitedUntil:        make(map[string]time.Time),
+		names:               make(map[string]string),
+	}
+}
+
+type discordDecoration struct {
+	dcInstance          *discordgo.Session
+	configStore         internal.ConfigStore
+	mapTwitchIdsToState *domain.LiveStates
+	i18n                internal.I18n
+
+	debouncer    *debouncer
+	mu           sync.Mutex
+	renames      map[string][]time.Time // Last renames of the counter channels, channelId as key
+	limitedUntil map[string]time.Time   // Counter channels rate limited by Discord, channelId as key
+	names        map[string]string      // Names given to the counter channels, channelId as key
+
+	presenceMu   sync.Mutex
+	presenceName string // Streamer shown in the status of the bot, empty when none
+}
+
+// HandleLiveState schedules the update of the counters of the guilds following the streamer and of the presence, the
+// changes within domain.DecorationDebounceDelay are grouped in a single update
+func (d *discordDecoration) HandleLiveState(state domain.LiveState) {
+	config := d.configStore.Get()
+	for guildId := range config.Discord.Counters {
+		isCounted := slices.ContainsFunc(config.Discord.Servers[guildId], func(notifier domain.DiscordNotifier) bool {
+			return notifier.TwitchId == state.TwitchId
+		})
+		if isCounted {
+			d.scheduleCounter(guildId, domain.DecorationDebounceDelay)
+		}
+	}
+
+	// Also scheduled when the presence was disabled by a reload, to clear it
+	d.debouncer.schedule(presenceKey, domain.DecorationDebounceDelay, func(context.Context) { d.updatePresence(false) })
+}
+
+// HandleReady sets the presence again, Discord drops it when the session identifies again after a reconnection
+func (d *discordDecoration) HandleReady() {
+	d.presenceMu.Lock()
+	d.presenceName = ""
+	d.presenceMu.Unlock()
+	d.updatePresence(false)
+}
+
+// Shutdown stops the scheduled renames and presence updates and waits for the running ones
+func (d *discordDecoration) Shutdown(ctx context.Context) error {
+	return d.debouncer.shutdown(ctx)
+}
+
+func (d *discordDecoration) scheduleCounter(guildId string, delay time.Duration) {
+	d.debouncer.schedule(guildId, delay, func(context.Context) { d.updateCounter(guildId) })
+}
+
+// updateCounter renames the counter channel of the guild with its number of live streamers. Discord allows
+// domain.ChannelRenameLimit renames by domain.ChannelRenameWindow, the changes in between are coalesced in the next
+// rename allowed
+func (d *discordDecoration) updateCounter(guildId string) {
+	config := d.configStore.Get()
+	counter, ok := config.Discord.Counters[guildId]
+	if !ok {
+		return
+	}
+
+	i18nMessages := d.i18n.GetMessages(counter.Lang).Discord.Counter
+	name := i18nMessages.Empty
+	if count := len(getLiveStreams(d.mapTwitchIdsToState, config.Discord.Servers[guildId])); count > 0 {
+		name = d.i18n.Format(i18nMessages.Name, map[string]string{"%count%": strconv.Itoa(count)})
+	}
+
+	d.mu.Lock()
+	if d.names[counter.ChannelId] == name {
+		d.mu.Unlock()
+		return
+	}
+	wait := d.getRenameWait(counter.ChannelId)
+	d.mu.Unlock()
+	if wait > 0 {
+		d.scheduleCounter(guildId, wait)
+		return
+	}
+
+	logger := internal.DiscordLog.With("guildId", guildId, "channelId", counter.ChannelId)
+	_, err := d.dcInstance.ChannelEdit(counter.ChannelId, &discordgo.ChannelEdit{Name: name}, discordgo.WithRetryOnRatelimit(false))
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		d.mu.Lock()
+		d.limitedUntil[counter.ChannelId] = time.Now().Add(rateLimitErr.RetryAfter)
+		d.mu.Unlock()
+		logger.Debug("Counter rename delayed, the channel is rate limited", "retryAfter", rateLimitErr.RetryAfter)
+		d.scheduleCounter(guildId, rateLimitErr.RetryAfter)
+		return
+	} else if err != nil {
+		logger.Warn("Failed to rename the counter channel", "error", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.names[counter.ChannelId] = name
+	renames := append(d.renames[counter.ChannelId], time.Now())
+	d.renames[counter.ChannelId] = renames[max(0, len(renames)-domain.ChannelRenameLimit):]
+}
+
+// getRenameWait returns the delay before the channel can be renamed again, d.mu must be held
+func (d *discordDecoration) getRenameWait(channelId string) time.Duration {
+	wait := time.Until(d.limitedUntil[channelId])
+	if renames := d.renames[channelId]; len(renames) >= domain.ChannelRenameLimit {
+		wait = max(wait, time.Until(renames[0].Add(domain.ChannelRenameWindow)))
+	}
+	return wait
+}
+
+// updatePresence shows a live streamer in the status of the bot, the one with the most viewers first. When several
+// streamers are live, they are shown in turn every rotateInterval.
+func (d *discordDecoration) updatePresence(rotate bool) {
+	d.presenceMu.Lock()
+	defer d.presenceMu.Unlock()
+
+	config := d.configStore.Get()
+	var names []string
+	if config.Discord.Presence.Active {
+		names = d.getLiveNames(config)
+	}
+
+	name := ""
+	if len(names) > 0 {
+		index := slices.Index(names, d.presenceName)
+		if index == -1 {
+			index = 0
+		} else if rotate {
+			index = (index + 1) % len(names)
+		}
+		name = names[index]
+	}
+	if len(names) > 1 {
+		d.debouncer.schedule(presenceRotationKey, config.Discord.Presence.RotateInterval, func(context.Context) { d.updatePresence(true) })
+	}
+	if name == d.presenceName {
+		return
+	}
+
+	activities := []*discordgo.Activity{}
+	if name != "" {
+		activities = append(activities, &discordgo.Activity{Name: name, Type: discordgo.ActivityTypeWatching})
+	}
+	if err := d.dcInstance.UpdateStatusComplex(discordgo.UpdateStatusData{Status: string(discordgo.StatusOnline), Activities: activities}); err != nil {
+		internal.DiscordLog.Warn("Failed to update the presence", "streamer", name, "error", err)
+		return
+	}
+	d.presenceName = name
+}
+
+// getLiveNames returns the display names of the live streamers of all the notifiers, sorted by viewers
+func (d *discordDecoration) getLiveNames(config *domain.Config) []string {
+	var notifiers []domain.DiscordNotifier
+	for _, guildNotifiers := range config.Discord.Servers {
+		notifiers = append(notifiers, guildNotifiers...)
+	}
+
+	streams := getLiveStreams(d.mapTwitchIdsToState, notifiers)
+	slices.SortStableFunc(streams, func(first, second liveStream) int {
+		return cmp.Or(
+			cmp.Compare(second.state.OnlineState.ViewerCount, first.state.OnlineState.ViewerCount),
+			cmp.Compare(first.state.TwitchId, second.state.TwitchId), // Servers are iterated in random order
+		)
+	})
+
+	names := make([]string, 0, len(streams))
+	for _, stream := range streams {
+		name := config.Twitch.UserResolver[stream.state.TwitchId].TwitchDisplayName
+		if name == "" {
+			name = stream.state.TwitchName
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,119 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiscordTask is a Discord call of a fan-out, Bucket is the discordgo rate limit bucket of its main request
+type DiscordTask struct {
+	Priority int // One of domain.DiscordPriority*, lowest first
+	Bucket   string
+	Run      func() error
+}
+
+// DiscordDispatcher runs the Discord calls of a fan-out concurrently, highest priority first. A task whose route
+// bucket is exhausted waits while the tasks of the other routes run, instead of holding a worker in discordgo.
+type DiscordDispatcher interface {
+	Run(tasks []DiscordTask) error
+	GetWaitTime(bucket string) time.Duration
+}
+
+func NewDiscordDispatcher(ratelimiter *discordgo.RateLimiter) DiscordDispatcher {
+	return &discordDispatcher{
+		ratelimiter: ratelimiter,
+		slots:       make(chan struct{}, domain.DiscordDispatchConcurrency),
+	}
+}
+
+type discordDispatcher struct {
+	ratelimiter *discordgo.RateLimiter
+	slots       chan struct{} // Shared by the concurrent fan-outs
+}
+
+// Run returns once every task ran, with their errors joined
+func (d *discordDispatcher) Run(tasks []DiscordTask) error {
+	pending := slices.Clone(tasks)
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Priority < pending[j].Priority })
+
+	var mu sync.Mutex
+	var errs []error
+	running := make(map[string]bool) // Buckets of the tasks in flight, their next task waits for the response headers
+	done := make(chan struct{})      // Closed and replaced when a task ends
+
+	// next removes the first task ready to run, it waits while every remaining task waits for its bucket
+	next := func() (DiscordTask, bool) {
+		for {
+			mu.Lock()
+			if len(pending) == 0 {
+				mu.Unlock()
+				return DiscordTask{}, false
+			}
+
+			wait := domain.DiscordBucketMaxWait
+			for index, task := range pending {
+				if running[task.Bucket] {
+					continue
+				}
+				if taskWait := d.GetWaitTime(task.Bucket); taskWait > 0 {
+					wait = min(wait, taskWait)
+					continue
+				}
+
+				pending = slices.Delete(pending, index, index+1)
+				running[task.Bucket] = true
+				mu.Unlock()
+				return task, true
+			}
+			taskDone := done
+			mu.Unlock()
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-taskDone:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}
+
+	var workers sync.WaitGroup
+	for range min(len(pending), domain.DiscordDispatchConcurrency) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for task, ok := next(); ok; task, ok = next() {
+				d.slots <- struct{}{}
+				err := task.Run()
+				<-d.slots
+
+				mu.Lock()
+				delete(running, task.Bucket)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				close(done)
+				done = make(chan struct{})
+				mu.Unlock()
+			}
+		}()
+	}
+	workers.Wait()
+	return errors.Join(errs...)
+}
+
+// GetWaitTime returns how long a request on the bucket would wait for its route or the global rate limit,
+// a bucket locked by a request in flight is reported busy for domain.DiscordBucketBusyWait
+func (d *discordDispatcher) GetWaitTime(bucket string) time.Duration {
+	b := d.ratelimiter.GetBucket(bucket)
+	if !b.TryLock() {
+		return domain.DiscordBucketBusyWait
+	}
+	defer b.Unlock()
+	return d.ratelimiter.GetWaitTime(b, 1)
+}
@@ -3,97 +3,239 @@ package usecase
 import (
 	"LiveStatus/src/domain"
 	"LiveStatus/src/internal"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
+	"math/rand/v2"
 	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type DiscordEvent interface {
 	HandleLiveState(state domain.LiveState) error
+	CleanOrphanEvents(mapTwitchIdsToState *domain.LiveStates) error
 }
 
-func NewDiscordEvent(dcInstance *discordgo.Session, dConfig domain.DiscordConfig, database internal.Database, i18n internal.I18n) DiscordEvent {
+func NewDiscordEvent(dcInstance *discordgo.Session, configStore internal.ConfigStore, database internal.Database, dispatcher DiscordDispatcher, i18n internal.I18n, metrics *internal.Metrics) DiscordEvent {
 	return &discordEvent{
-		database:   database,
-		dcInstance: dcInstance,
-		dConfig:    dConfig,
-		i18n:       i18n,
+		database:    database,
+		dcInstance:  dcInstance,
+		configStore: configStore,
+		dispatcher:  dispatcher,
+		i18n:        i18n,
+		metrics:     metrics,
 	}
 }
 
 type discordEvent struct {
-	database   internal.Database
-	dcInstance *discordgo.Session
-	dConfig    domain.DiscordConfig
-	i18n       internal.I18n
+	database    internal.Database
+	dcInstance  *discordgo.Session
+	configStore internal.ConfigStore
+	dispatcher  DiscordDispatcher
+	i18n        internal.I18n
+	metrics     *internal.Metrics
 }
 
-func (m discordEvent) HandleLiveState(state domain.LiveState) error {
+// HandleLiveState creates, edits or ends the event of every guild of the streamer concurrently, see DiscordDispatcher.
+// A live event is only edited when its content changed or its end time must be renewed, see domain.DiscordEventRecord
+func (m discordEvent) HandleLiveState(globalState domain.LiveState) error {
+	config := m.configStore.Get()
+	var tasks []DiscordTask
 	var errs []error
-	for guildId, notifiers := range m.dConfig.Servers {
+	for guildId, notifiers := range config.Discord.Servers {
 		for _, notifier := range notifiers {
-			if notifier.Message.ChannelId == "" || notifier.TwitchId != state.TwitchId || !notifier.Event.Active {
+			if notifier.TwitchId != globalState.TwitchId || !notifier.Event.Active {
 				continue
 			}
 
-			dbEventId, err := m.database.GetEventId(state.TwitchId, guildId)
+			state := notifier.FilterLiveState(globalState)
+			dbEvent, err := m.database.GetEvent(state.TwitchId, guildId)
 			if err != nil {
-				errs = append(errs, errors.New(fmt.Sprintf("failed to get dbEventId in guild %s: %v", guildId, err)))
+				errs = append(errs, fmt.Errorf("failed to get dbEvent in guild %s: %w", guildId, err))
+				continue
 			}
 
-			// Check if the event is still valid and not deleted
-			if dbEventId != "" {
-				evt, evtErr := m.dcInstance.GuildScheduledEvent(guildId, dbEventId, false)
-				if (evt != nil && slices.Contains(domain.EventStatusToSkip, evt.Status)) || evtErr != nil {
-					dbEventId = ""
+			switch {
+			case dbEvent.Id != "" && !state.IsOnline():
+				tasks = append(tasks, DiscordTask{
+					Priority: domain.DiscordPriorityUpdate,
+					Bucket:   discordgo.EndpointGuildScheduledEvent(guildId, dbEvent.Id),
+					Run: func() error {
+						if err := m.endEvent(guildId, dbEvent.Id, notifier, state); err != nil {
+							return err
+						}
+						return m.setEvent(guildId, state.TwitchId, domain.DiscordEventRecord{})
+					},
+				})
+			case dbEvent.Id != "":
+				params := m.getEventParams(notifier.Lang, state, config.Discord.EventExtension)
+				if getContentHash(params) == dbEvent.ContentHash && getImageHash(state) == dbEvent.ImageHash &&
+					!dbEvent.NeedsRenewal(config.Discord.EventExtension) {
+					continue
 				}
+				tasks = append(tasks, DiscordTask{
+					Priority: domain.DiscordPriorityUpdate,
+					Bucket:   discordgo.EndpointGuildScheduledEvent(guildId, dbEvent.Id),
+					Run:      func() error { return m.updateEvent(guildId, dbEvent, notifier, state, params) },
+				})
+			// Rules are evaluated again on every channel.update, a later match will create the event
+			case state.IsOnline() && notifier.EvaluateRules(state) != domain.RuleActionSilent:
+				params := m.getEventParams(notifier.Lang, state, config.Discord.EventExtension)
+				tasks = append(tasks, DiscordTask{
+					Priority: domain.DiscordPriorityAnnouncement,
+					Bucket:   discordgo.EndpointGuildScheduledEvents(guildId),
+					Run:      func() error { return m.createEvent(guildId, state, params) },
+				})
 			}
+		}
+	}
 
-			if state.IsOnline() {
-				// Send or edit the event
-				var newEvent *discordgo.GuildScheduledEvent
-				if dbEventId != "" {
-					newEvent, err = m.dcInstance.GuildScheduledEventEdit(guildId, dbEventId, m.getEventParams(notifier.Lang, state))
-				} else {
-					eventParams := m.getEventParams(notifier.Lang, state)
-					startDate := time.Now().Add(time.Second * 10) // Add 10 seconds to the current time to deal with time sync issues
-					eventParams.ScheduledStartTime = &startDate
-					newEvent, err = m.dcInstance.GuildScheduledEventCreate(guildId, eventParams)
-				}
-				if err != nil {
-					errs = append(errs, errors.New(fmt.Sprintf("failed to send discordEvent %s in guild %s: %v", dbEventId, guildId, err)))
-				}
+	return errors.Join(append(errs, m.dispatcher.Run(tasks))...)
+}
 
-				// Save the new event id
-				if state.IsOnline() && newEvent != nil {
-					dbEventId = newEvent.ID
-				} else {
-					dbEventId = ""
-				}
+// CleanOrphanEvents ends the active events of the bot whose id is not stored, left by a crash between their creation and
+// their storage. They are found by domain.EventDescriptionMarker and ended like the event of their notifier
+func (m discordEvent) CleanOrphanEvents(mapTwitchIdsToState *domain.LiveStates) error {
+	botUser, err := m.dcInstance.User("@me")
+	if err != nil {
+		return fmt.Errorf("failed to get the bot user: %w", err)
+	}
+	storedIds, err := m.database.GetAllEventIds()
+	if err != nil {
+		return fmt.Errorf("failed to get the stored events: %w", err)
+	}
 
-				if err = m.database.SetEventId(state.TwitchId, guildId, dbEventId); err != nil {
-					errs = append(errs, errors.New(fmt.Sprintf("failed to save newEventId in guild %s: %v", guildId, err)))
-				}
-			} else if dbEventId != "" {
-				if err = m.dcInstance.GuildScheduledEventDelete(guildId, dbEventId); err != nil {
-					errs = append(errs, errors.New(fmt.Sprintf("failed to delete discordEvent %s in guild %s: %v", dbEventId, guildId, err)))
+	var tasks []DiscordTask
+	var errs []error
+	for guildId, notifiers := range m.configStore.Get().Discord.Servers {
+		events, err := m.dcInstance.GuildScheduledEvents(guildId, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list the events of guild %s: %w", guildId, err))
+			continue
+		}
+
+		for _, event := range events {
+			if storedIds[event.ID] || event.CreatorID != botUser.ID || event.Status != discordgo.GuildScheduledEventStatusActive ||
+				!strings.HasSuffix(event.Description, domain.EventDescriptionMarker) {
+				continue
+			}
+
+			// The notifier streaming at the event location, without it the event is deleted
+			var eventNotifier domain.DiscordNotifier
+			var state domain.LiveState
+			for _, notifier := range notifiers {
+				if notifierState, ok := mapTwitchIdsToState.Get(notifier.TwitchId); ok && notifierState.LiveUrl() == event.EntityMetadata.Location {
+					eventNotifier, state = notifier, notifier.FilterLiveState(*notifierState)
+					break
 				}
 			}
+
+			internal.DiscordLog.Info("Ending orphan event", "guildId", guildId, "eventId", event.ID, "location", event.EntityMetadata.Location)
+			eventId := event.ID
+			tasks = append(tasks, DiscordTask{
+				Priority: domain.DiscordPriorityUpdate,
+				Bucket:   discordgo.EndpointGuildScheduledEvent(guildId, eventId),
+				Run:      func() error { return m.endEvent(guildId, eventId, eventNotifier, state) },
+			})
+		}
+	}
+
+	return errors.Join(append(errs, m.dispatcher.Run(tasks))...)
+}
+
+// endEvent completes or deletes the event depending on the notifier, see domain.DiscordNotifier.Event.Complete.
+// An event already gone from Discord is ended too
+func (m discordEvent) endEvent(guildId string, eventId string, notifier domain.DiscordNotifier, state domain.LiveState) error {
+	if notifier.Event.Complete {
+		return m.completeEvent(guildId, eventId, notifier, state)
+	}
+
+	err := m.dcInstance.GuildScheduledEventDelete(guildId, eventId)
+	if err != nil && !isDiscordEventGone(err) {
+		return fmt.Errorf("failed to delete discordEvent %s in guild %s: %w", eventId, guildId, err)
+	}
+	if err == nil {
+		m.metrics.DiscordEvents.Inc(internal.MetricsActionDeleted)
+	}
+	return nil
+}
+
+// completeEvent keeps the event in the history of the guild, with the ended texts
+func (m discordEvent) completeEvent(guildId string, eventId string, notifier domain.DiscordNotifier, state domain.LiveState) error {
+	i18nMessages := m.i18n.GetMessages(notifier.Lang).Discord.Event.Ended
+	streamVariables := state.GetStreamVariables("R")
+	_, err := m.dcInstance.GuildScheduledEventEdit(guildId, eventId, &discordgo.GuildScheduledEventParams{
+		Name:        m.i18n.Format(i18nMessages.Title, streamVariables),
+		Description: getEventDescription(m.i18n.Format(i18nMessages.Description, streamVariables)),
+		Status:      discordgo.GuildScheduledEventStatusCompleted,
+	})
+	if err != nil && !isDiscordEventGone(err) {
+		return fmt.Errorf("failed to complete discordEvent %s in guild %s: %w", eventId, guildId, err)
+	}
+	if err == nil {
+		m.metrics.DiscordEvents.Inc(internal.MetricsActionEdited)
+	}
+	return nil
+}
+
+// updateEvent edits the stored event, the cover image is only uploaded when it changed. An event deleted or ended
+// on Discord is created again instead of checking it before every edit
+func (m discordEvent) updateEvent(guildId string, dbEvent domain.DiscordEventRecord, notifier domain.DiscordNotifier, state domain.LiveState, params *discordgo.GuildScheduledEventParams) error {
+	editParams := *params
+	if getImageHash(state) == dbEvent.ImageHash {
+		editParams.Image = ""
+	}
+
+	_, err := m.dcInstance.GuildScheduledEventEdit(guildId, dbEvent.Id, &editParams)
+	if isDiscordEventGone(err) {
+		if notifier.EvaluateRules(state) == domain.RuleActionSilent {
+			return m.setEvent(guildId, state.TwitchId, domain.DiscordEventRecord{})
 		}
+		return m.createEvent(guildId, state, params)
+	} else if err != nil {
+		return fmt.Errorf("failed to edit discordEvent %s in guild %s: %w", dbEvent.Id, guildId, err)
 	}
+	m.metrics.DiscordEvents.Inc(internal.MetricsActionEdited)
+	return m.setEvent(guildId, state.TwitchId, newEventRecord(dbEvent.Id, state, params))
+}
 
-	return errors.Join(errs...)
+func (m discordEvent) createEvent(guildId string, state domain.LiveState, params *discordgo.GuildScheduledEventParams) error {
+	createParams := *params
+	startDate := time.Now().Add(time.Second * 10) // Add 10 seconds to the current time to deal with time sync issues
+	createParams.ScheduledStartTime = &startDate
+	newEvent, err := m.dcInstance.GuildScheduledEventCreate(guildId, &createParams)
+	if err != nil {
+		return fmt.Errorf("failed to create discordEvent in guild %s: %w", guildId, err)
+	}
+	m.metrics.DiscordEvents.Inc(internal.MetricsActionCreated)
+	return m.setEvent(guildId, state.TwitchId, newEventRecord(newEvent.ID, state, params))
 }
 
-func (m discordEvent) getEventParams(lang string, state domain.LiveState) *discordgo.GuildScheduledEventParams {
+func (m discordEvent) setEvent(guildId string, twitchId string, event domain.DiscordEventRecord) error {
+	if err := m.database.SetEvent(twitchId, guildId, event); err != nil {
+		return fmt.Errorf("failed to save event %q in guild %s: %w", event.Id, guildId, err)
+	}
+	return nil
+}
+
+// isDiscordEventGone reports whether the event was deleted or ended on Discord, see domain.EventGoneErrorCodes
+func isDiscordEventGone(err error) bool {
+	var restErr *discordgo.RESTError
+	return isDiscordNotFound(err) ||
+		errors.As(err, &restErr) && restErr.Message != nil && slices.Contains(domain.EventGoneErrorCodes, restErr.Message.Code)
+}
+
+func (m discordEvent) getEventParams(lang string, state domain.LiveState, extension time.Duration) *discordgo.GuildScheduledEventParams {
 	i18nMessages := m.i18n.GetMessages(lang).Discord.Event
 	streamVariables := state.GetStreamVariables("R")
 	return &discordgo.GuildScheduledEventParams{
 		Name:             m.i18n.Format(i18nMessages.Title, streamVariables),
-		Description:      m.i18n.Format(i18nMessages.Description, streamVariables),
-		ScheduledEndTime: getFakedEventEndDate(),
+		Description:      getEventDescription(m.i18n.Format(i18nMessages.Description, streamVariables)),
+		ScheduledEndTime: getEventEndTime(extension),
 		PrivacyLevel:     discordgo.GuildScheduledEventPrivacyLevelGuildOnly,
 		Status:           discordgo.GuildScheduledEventStatusActive,
 		EntityType:       discordgo.GuildScheduledEventEntityTypeExternal,
@@ -104,7 +246,40 @@ func (m discordEvent) getEventParams(lang string, state domain.LiveState) *disco
 	}
 }
 
-func getFakedEventEndDate() *time.Time {
-	t := time.Now().Add(domain.FakeEndDateDelay)
+// getEventDescription truncates the description to end it with domain.EventDescriptionMarker
+func getEventDescription(description string) string {
+	maxLength := domain.EventDescriptionMaxLength - utf8.RuneCountInString(domain.EventDescriptionMarker)
+	if runes := []rune(description); len(runes) > maxLength {
+		description = string(runes[:maxLength])
+	}
+	return description + domain.EventDescriptionMarker
+}
+
+// getEventEndTime returns the end time of a live event, the jitter spreads the renewals of the events created together
+func getEventEndTime(extension time.Duration) *time.Time {
+	t := time.Now().Add(extension - rand.N(extension/domain.EventEndJitterRatio))
 	return &t
 }
+
+func newEventRecord(eventId string, state domain.LiveState, params *discordgo.GuildScheduledEventParams) domain.DiscordEventRecord {
+	return domain.DiscordEventRecord{
+		Id:          eventId,
+		EndTime:     *params.ScheduledEndTime,
+		ContentHash: getContentHash(params),
+		ImageHash:   getImageHash(state),
+	}
+}
+
+func getContentHash(params *discordgo.GuildScheduledEventParams) string {
+	return getEventHash(params.Name, params.Description, params.EntityMetadata.Location)
+}
+
+// getImageHash identifies the cover by stream and game, the thumbnail refreshed by the image cache is not uploaded again
+func getImageHash(state domain.LiveState) string {
+	return getEventHash(state.OnlineState.StreamImageUrl, state.OnlineState.StartedAt.Format(time.RFC3339), state.OnlineState.GameName)
+}
+
+func getEventHash(values ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(values, "\x00")))
+	return hex.EncodeToString(hash[:8])
+}
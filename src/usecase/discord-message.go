@@ -6,121 +6,383 @@ import (
 	"errors"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
+	"net/http"
 	"slices"
 	"time"
 )
 
 type DiscordMessage interface {
 	HandleLiveState(state domain.LiveState) error
-	getComponents(lang string, state domain.LiveState) []discordgo.MessageComponent
-	getEmbed(lang string, state domain.LiveState) *discordgo.MessageEmbed
+	HandleRaid(raid domain.TwitchRaid) error
+	DeleteMessage(twitchId string, channelId string) error
+	RepostMessage(state domain.LiveState, channelId string) error
+	ArchiveThreads() error
+	OutboxDeliverer
+	getComponents(lang string, template string, state domain.LiveState) []discordgo.MessageComponent
+	getEmbed(lang string, template string, state domain.LiveState) *discordgo.MessageEmbed
 }
 
-func NewDiscordMessage(dcInstance *discordgo.Session, dConfig domain.DiscordConfig, database internal.Database, i18n internal.I18n) DiscordMessage {
+func NewDiscordMessage(dcInstance *discordgo.Session, configStore internal.ConfigStore, database internal.Database, outbox NotificationOutbox, dispatcher DiscordDispatcher, i18n internal.I18n, metrics *internal.Metrics) DiscordMessage {
 	return &discordMessage{
-		database:   database,
-		dConfig:    dConfig,
-		dcInstance: dcInstance,
-		i18n:       i18n,
+		database:    database,
+		configStore: configStore,
+		dcInstance:  dcInstance,
+		outbox:      outbox,
+		dispatcher:  dispatcher,
+		i18n:        i18n,
+		metrics:     metrics,
+
+		crosspostLimits: newCrosspostLimits(),
+		webhooks:        newWebhookCache(),
 	}
 }
 
 type discordMessage struct {
-	database   internal.Database
-	dConfig    domain.DiscordConfig
-	dcInstance *discordgo.Session
-	i18n       internal.I18n
+	database    internal.Database
+	configStore internal.ConfigStore
+	dcInstance  *discordgo.Session
+	outbox      NotificationOutbox
+	dispatcher  DiscordDispatcher
+	i18n        internal.I18n
+	metrics     *internal.Metrics
+
+	crosspostLimits *crosspostLimits
+	webhooks        *webhookCache
 }
 
-func (m discordMessage) HandleLiveState(state domain.LiveState) error {
+// HandleLiveState queues one outbox job by notifier of the streamer, the error only reports the jobs that could not be queued
+func (m discordMessage) HandleLiveState(globalState domain.LiveState) error {
+	var jobs []domain.OutboxJob
 	var errs []error
-	for guildId, notifiers := range m.dConfig.Servers {
+	for guildId, notifiers := range m.configStore.Get().Discord.Servers {
 		for _, notifier := range notifiers {
-			if notifier.Message.ChannelId == "" || notifier.TwitchId != state.TwitchId || !notifier.Message.Active {
+			if notifier.Message.ChannelId == "" || notifier.TwitchId != globalState.TwitchId || !notifier.Message.Active {
 				continue
 			}
 
-			dbMessageId, err := m.database.GetMessageId(state.TwitchId, notifier.Message.ChannelId)
+			state := notifier.FilterLiveState(globalState)
+			intent, err := m.getIntent(state, notifier)
 			if err != nil {
-				errs = append(errs, errors.New(fmt.Sprintf("failed to get dbMessageId to channel %s in guild %s: %v", notifier.Message.ChannelId, guildId, err)))
+				errs = append(errs, fmt.Errorf("failed to plan discordMessage to channel %s in guild %s: %w", notifier.Message.ChannelId, guildId, err))
+			} else if intent != "" {
+				jobs = append(jobs, domain.NewOutboxJob(intent, guildId, notifier, state))
 			}
+		}
+	}
 
-			// Check if the message is still valid and not deleted
-			if dbMessageId != "" {
-				if _, msgErr := m.dcInstance.ChannelMessage(notifier.Message.ChannelId, dbMessageId); msgErr != nil {
-					dbMessageId = ""
-				}
-			}
+	return errors.Join(append(errs, m.outbox.Enqueue(jobs))...)
+}
 
-			// Skip if the stream is offline and there is no message to edit
-			if dbMessageId == "" && !state.IsOnline() {
-				return nil
-			}
+// getIntent returns the job to queue for the notifier, empty when there is nothing to update: the stream is offline
+// or filtered out by the rules and there is neither a message nor a queued job. Rules are evaluated again on every
+// channel.update, a later match will send the message.
+func (m discordMessage) getIntent(state domain.LiveState, notifier domain.DiscordNotifier) (string, error) {
+	dbMessageId, err := m.database.GetMessageId(state.TwitchId, notifier.Message.ChannelId)
+	if err != nil {
+		return "", err
+	} else if dbMessageId != "" {
+		return domain.OutboxIntentEdit, nil
+	}
 
-			embed := m.getEmbed(notifier.Lang, state)
-			var newMessage *discordgo.Message
-			var components []discordgo.MessageComponent
-			if notifier.Message.Buttons {
-				components = m.getComponents(notifier.Lang, state)
-			}
+	if state.IsOnline() && notifier.EvaluateRules(state) != domain.RuleActionSilent {
+		return domain.OutboxIntentSend, nil
+	}
 
-			// Send or edit the message
-			if dbMessageId != "" {
-				newMessage, err = m.dcInstance.ChannelMessageEditComplex(&discordgo.MessageEdit{
-					Channel:    notifier.Message.ChannelId,
-					ID:         dbMessageId,
-					Components: &components,
-					Content:    getContent(state, notifier),
-					Embed:      embed,
-				})
+	// A queued send may not be delivered yet, the edit follows it
+	pending, err := m.outbox.HasPendingJob(state.TwitchId, notifier.Message.ChannelId)
+	if err != nil || !pending {
+		return "", err
+	}
+	return domain.OutboxIntentEdit, nil
+}
 
-			} else {
-				newMessage, err = m.dcInstance.ChannelMessageSendComplex(notifier.Message.ChannelId, &discordgo.MessageSend{
-					Components: components,
-					Content:    *getContent(state, notifier),
-					Embed:      embed,
-				})
-			}
-			if err != nil {
-				errs = append(errs, errors.New(fmt.Sprintf("failed to send discordMessage %s in channel %s in guild %s: %v", dbMessageId, notifier.Message.ChannelId, guildId, err)))
-			}
+// DeleteMessage queues the deletion of the stored message of the streamer in the channel, the next update of a live stream posts a new one
+func (m discordMessage) DeleteMessage(twitchId string, channelId string) error {
+	messageId, err := m.database.GetMessageId(twitchId, channelId)
+	if err != nil {
+		return err
+	} else if messageId == "" {
+		return domain.ErrAnnouncementNotFound
+	}
 
-			// Save the new message id
-			if state.IsOnline() && newMessage != nil {
-				dbMessageId = newMessage.ID
-			} else {
-				dbMessageId = ""
-			}
+	guildId, notifier, ok := m.findChannelNotifier(twitchId, channelId)
+	if !ok {
+		return domain.ErrAnnouncementNotFound
+	}
+	state := domain.LiveState{TwitchId: twitchId} // Not rendered
+	return m.outbox.Enqueue([]domain.OutboxJob{domain.NewOutboxJob(domain.OutboxIntentDelete, guildId, notifier, state)})
+}
+
+// RepostMessage queues the deletion of the stored message, when there is one, then a new message with its mention when the policy allows it
+func (m discordMessage) RepostMessage(globalState domain.LiveState, channelId string) error {
+	guildId, notifier, ok := m.findChannelNotifier(globalState.TwitchId, channelId)
+	if !ok {
+		return domain.ErrAnnouncementNotFound
+	}
+
+	state := notifier.FilterLiveState(globalState)
+	return m.outbox.Enqueue([]domain.OutboxJob{
+		domain.NewOutboxJob(domain.OutboxIntentDelete, guildId, notifier, state),
+		domain.NewOutboxJob(domain.OutboxIntentSend, guildId, notifier, state),
+	})
+}
+
+// GetDeliveryWait returns the rate limit wait of the channel route used by the job
+func (m discordMessage) GetDeliveryWait(job domain.OutboxJob) time.Duration {
+	bucket := discordgo.EndpointChannelMessage(job.Notifier.Message.ChannelId, "")
+	if job.Intent == domain.OutboxIntentSend {
+		bucket = discordgo.EndpointChannelMessages(job.Notifier.Message.ChannelId)
+	}
+	return m.dispatcher.GetWaitTime(bucket)
+}
+
+// Deliver sends, edits or deletes the message of an outbox job. The intent is checked against the stored message,
+// a job delivered twice edits the message instead of posting a duplicate
+func (m discordMessage) Deliver(job domain.OutboxJob) error {
+	guildId, notifier, state := job.GuildId, job.Notifier, job.State
+	channelId := notifier.Message.ChannelId
+	dbMessageId, err := m.database.GetMessageId(state.TwitchId, channelId)
+	if err != nil {
+		return fmt.Errorf("failed to get dbMessageId to channel %s in guild %s: %w", channelId, guildId, err)
+	}
+
+	thread, err := m.database.GetThread(state.TwitchId, channelId)
+	if err != nil {
+		return fmt.Errorf("failed to get the thread of channel %s in guild %s: %w", channelId, guildId, err)
+	}
+
+	if job.Intent == domain.OutboxIntentDelete {
+		return m.deleteMessage(guildId, state.TwitchId, notifier, dbMessageId, thread)
+	}
+
+	rule, _ := notifier.GetStreamTypeRule(state.OnlineState.Type)
+	embed := m.getEmbed(notifier.Lang, rule.Template, state)
+	var newMessage *discordgo.Message
+	var components []discordgo.MessageComponent
+	if notifier.Message.Buttons {
+		components = m.getComponents(notifier.Lang, rule.Template, state)
+	}
+
+	// Edit the message, a 404 means it was deleted on Discord
+	if dbMessageId != "" {
+		var content *string // Keep the mention of the first message while online
+		if !state.IsOnline() {
+			content = new(string)
+		}
+		edit := &discordgo.MessageEdit{
+			Channel:         thread.GetMessageChannelId(channelId, dbMessageId),
+			ID:              dbMessageId,
+			Components:      &components,
+			Content:         content,
+			Embed:           embed,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		}
+		if notifier.Message.Webhook.IsActive() {
+			newMessage, err = m.editWebhookMessage(notifier, edit)
+		} else {
+			newMessage, err = m.dcInstance.ChannelMessageEditComplex(edit)
+		}
+		if isDiscordNotFound(err) {
+			dbMessageId = ""
+		} else if err != nil {
+			return fmt.Errorf("failed to edit discordMessage %s in channel %s in guild %s: %w", dbMessageId, channelId, guildId, err)
+		} else {
+			m.metrics.DiscordMessages.Inc(internal.MetricsActionEdited)
+		}
+	}
+
+	// The thread follows the stream until its recap, even when the announcement was deleted
+	if thread.Id != "" && !thread.IsEnded() && (dbMessageId != "" || !state.IsOnline()) {
+		if err = m.updateThread(notifier, state, thread, job.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	// Forget the deleted message when the stream is offline or filtered out by the rules
+	sent, mention := dbMessageId == "", false
+	if sent && (!state.IsOnline() || notifier.EvaluateRules(state) == domain.RuleActionSilent) {
+		if err = m.database.SetMessageId(state.TwitchId, channelId, ""); err != nil {
+			return fmt.Errorf("failed to forget discordMessage in channel %s in guild %s: %w", channelId, guildId, err)
+		}
+		return nil
+	}
 
-			if err = m.database.SetMessageId(state.TwitchId, notifier.Message.ChannelId, dbMessageId); err != nil {
-				errs = append(errs, errors.New(fmt.Sprintf("failed to save newMessageId to channel %s in guild %s: %v", notifier.Message.ChannelId, guildId, err)))
+	// Send the message, the thread of a previous stream is archived first
+	if sent {
+		if thread.Id != "" {
+			if err = m.archiveThread(thread); err != nil {
+				return err
 			}
 		}
+		content, allowedMentions := m.getMention(state, notifier)
+		newMessage, err = m.sendMessage(guildId, notifier, state, &discordgo.MessageSend{
+			Components:      components,
+			Content:         content,
+			Embed:           embed,
+			AllowedMentions: allowedMentions,
+		})
+		if err != nil {
+			return err
+		}
+		m.metrics.DiscordMessages.Inc(internal.MetricsActionCreated)
+		mention = content != ""
+	}
+
+	// Save the new message id first, a failed job is delivered again
+	dbMessageId = ""
+	if state.IsOnline() {
+		dbMessageId = newMessage.ID
+	}
+	if err = m.database.SetMessageId(state.TwitchId, channelId, dbMessageId); err != nil {
+		return fmt.Errorf("failed to save newMessageId to channel %s in guild %s: %w", channelId, guildId, err)
 	}
 
-	return errors.Join(errs...)
+	// The history is informative, its errors do not deliver the job again
+	var recordErr error
+	if sent {
+		recordErr = m.recordNotification(guildId, state.TwitchId, newMessage, domain.NotificationActionPosted, mention)
+	} else if !state.IsOnline() {
+		recordErr = m.recordNotification(guildId, state.TwitchId, newMessage, domain.NotificationActionOffline, false)
+	}
+	if recordErr != nil {
+		internal.DiscordLog.Warn("Failed to record the notification", "error", recordErr)
+	}
+	if mention {
+		if err = m.recordMention(state.TwitchId, notifier); err != nil {
+			internal.DiscordLog.Warn("Failed to save the mention history", "guildId", guildId, "channelId", channelId, "error", err)
+		}
+	}
+	return nil
 }
 
-func getContent(state domain.LiveState, notifier domain.DiscordNotifier) *string {
-	str := ""
-	if state.IsOnline() {
-		if slices.Contains(domain.CustomMentions, notifier.Message.RoleMentionId) {
-			str = fmt.Sprintf("@%s", notifier.Message.RoleMentionId)
-		} else if notifier.Message.RoleMentionId != "" {
-			str = fmt.Sprintf("<@&%s>", notifier.Message.RoleMentionId)
+// deleteMessage deletes the message and forgets it, a message already deleted on Discord is only forgotten.
+// A forum post is deleted with its message, the thread of a message is archived
+func (m discordMessage) deleteMessage(guildId string, twitchId string, notifier domain.DiscordNotifier, messageId string, thread domain.DiscordThread) error {
+	if messageId == "" {
+		return nil
+	}
+
+	channelId := notifier.Message.ChannelId
+	forumPost := thread.Forum && thread.Id == messageId
+	var err error
+	if forumPost {
+		_, err = m.dcInstance.ChannelDelete(thread.Id)
+	} else if notifier.Message.Webhook.IsActive() {
+		err = m.deleteWebhookMessage(notifier, messageId)
+	} else {
+		err = m.dcInstance.ChannelMessageDelete(channelId, messageId)
+	}
+	if err != nil && !isDiscordNotFound(err) {
+		return fmt.Errorf("failed to delete discordMessage %s in channel %s in guild %s: %w", messageId, channelId, guildId, err)
+	}
+	if err == nil {
+		m.metrics.DiscordMessages.Inc(internal.MetricsActionDeleted)
+	}
+
+	// The forum post is gone with its message, the thread of a message is archived
+	var threadErr error
+	if forumPost {
+		threadErr = m.database.SetThread(twitchId, channelId, domain.DiscordThread{})
+	} else if thread.Id != "" {
+		threadErr = m.archiveThread(thread)
+	}
+	if threadErr != nil {
+		return threadErr
+	}
+	if err = m.database.SetMessageId(twitchId, channelId, ""); err != nil {
+		return err
+	}
+
+	deleted := &discordgo.Message{ID: messageId, ChannelID: channelId}
+	if err = m.recordNotification(guildId, twitchId, deleted, domain.NotificationActionDeleted, false); err != nil {
+		internal.DiscordLog.Warn("Failed to record the notification", "error", err)
+	}
+	return nil
+}
+
+// findChannelNotifier returns the notifier of the streamer posting in the channel
+func (m discordMessage) findChannelNotifier(twitchId string, channelId string) (string, domain.DiscordNotifier, bool) {
+	for guildId, notifiers := range m.configStore.Get().Discord.Servers {
+		for _, notifier := range notifiers {
+			if notifier.TwitchId == twitchId && notifier.Message.ChannelId == channelId {
+				return guildId, notifier, true
+			}
 		}
 	}
-	return &str
+	return "", domain.DiscordNotifier{}, false
+}
+
+// recordNotification adds the message to the notification history of the guild shown in the dashboard
+func (m discordMessage) recordNotification(guildId string, twitchId string, message *discordgo.Message, action string, mention bool) error {
+	err := m.database.AddNotificationRecord(guildId, domain.NotificationRecord{
+		Time:      time.Now(),
+		TwitchId:  twitchId,
+		ChannelId: message.ChannelID,
+		MessageId: message.ID,
+		Action:    action,
+		Mention:   mention,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save the notification history of guild %s: %w", guildId, err)
+	}
+	return nil
+}
+
+// getMention returns the content and the allowed mentions of a new message, the mention is dropped
+// when the notifier rules or its MentionPolicy (cooldown, daily limit, quiet hours) forbid it
+func (m discordMessage) getMention(state domain.LiveState, notifier domain.DiscordNotifier) (string, *discordgo.MessageAllowedMentions) {
+	allowedMentions := &discordgo.MessageAllowedMentions{}
+	roleMentionId := notifier.Message.RoleMentionId
+	if !state.IsOnline() || roleMentionId == "" || !notifier.ShouldMention(state) {
+		return "", allowedMentions
+	}
+
+	history, err := m.database.GetMentionHistory(state.TwitchId, notifier.Message.ChannelId)
+	if err != nil {
+		internal.DiscordLog.Error("getMention GetMentionHistory failed", "twitchId", state.TwitchId, "channelId", notifier.Message.ChannelId, "error", err)
+	}
+	if !notifier.Message.MentionPolicy.Allows(time.Now(), history) {
+		return "", allowedMentions
+	}
+
+	if slices.Contains(domain.CustomMentions, roleMentionId) {
+		allowedMentions.Parse = []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeEveryone}
+	} else {
+		allowedMentions.Roles = []string{roleMentionId}
+	}
+	return getRoleMention(roleMentionId), allowedMentions
+}
+
+// isDiscordNotFound reports whether Discord answered 404, e.g. the message was deleted by a moderator
+func isDiscordNotFound(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound
+}
+
+func getRoleMention(roleMentionId string) string {
+	if slices.Contains(domain.CustomMentions, roleMentionId) {
+		return fmt.Sprintf("@%s", roleMentionId)
+	}
+	return fmt.Sprintf("<@&%s>", roleMentionId)
+}
+
+func (m discordMessage) recordMention(twitchId string, notifier domain.DiscordNotifier) error {
+	history, err := m.database.GetMentionHistory(twitchId, notifier.Message.ChannelId)
+	if err != nil {
+		return err
+	}
+	return m.database.SetMentionHistory(twitchId, notifier.Message.ChannelId, notifier.Message.MentionPolicy.Record(time.Now(), history))
 }
 
-func (m discordMessage) getComponents(lang string, state domain.LiveState) []discordgo.MessageComponent {
+func (m discordMessage) getComponents(lang string, template string, state domain.LiveState) []discordgo.MessageComponent {
 	i18nMessages := m.i18n.GetMessages(lang).Discord.Embed
 	streamVariables := state.GetStreamVariables("R")
 	label := m.i18n.Format(i18nMessages.Offline.Button.Label, streamVariables)
 	emoji := m.i18n.Format(i18nMessages.Offline.Button.Emoji, streamVariables)
 	if state.IsOnline() {
-		label = m.i18n.Format(i18nMessages.Online.Button.Label, streamVariables)
-		emoji = m.i18n.Format(i18nMessages.Online.Button.Emoji, streamVariables)
+		online := i18nMessages.GetOnline(template)
+		label = m.i18n.Format(online.Button.Label, streamVariables)
+		emoji = m.i18n.Format(online.Button.Emoji, streamVariables)
 	}
 
 	return []discordgo.MessageComponent{
@@ -138,7 +400,7 @@ func (m discordMessage) getComponents(lang string, state domain.LiveState) []dis
 		}}
 }
 
-func (m discordMessage) getEmbed(lang string, state domain.LiveState) *discordgo.MessageEmbed {
+func (m discordMessage) getEmbed(lang string, template string, state domain.LiveState) *discordgo.MessageEmbed {
 	i18nMessages := m.i18n.GetMessages(lang).Discord.Embed
 	streamVariables := state.GetStreamVariables("R")
 
@@ -162,10 +424,11 @@ func (m discordMessage) getEmbed(lang string, state domain.LiveState) *discordgo
 	}
 
 	if state.IsOnline() {
+		online := i18nMessages.GetOnline(template)
 		color = domain.EmbedColorOnline
-		description = m.i18n.Format(i18nMessages.Online.Description, streamVariables)
-		title = m.i18n.Format(i18nMessages.Online.Title, streamVariables)
-		addFields(i18nMessages.Online.Fields)
+		description = m.i18n.Format(online.Description, streamVariables)
+		title = m.i18n.Format(online.Title, streamVariables)
+		addFields(online.Fields)
 		image = &discordgo.MessageEmbedImage{
 			URL:    fmt.Sprintf("%s?noCache%d", state.OnlineState.StreamImageUrl, time.Now().Unix()),
 			Height: domain.StreamImageHeight,
@@ -0,0 +1,231 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendMessage posts the announcement of a new stream with its thread, see domain.ThreadPolicy, and crossposts it.
+// In a forum channel, the announcement is the first message of a post tagged with the game. A webhook posts in the
+// channel without checking it, the bot may not see it
+func (m discordMessage) sendMessage(guildId string, notifier domain.DiscordNotifier, state domain.LiveState, message *discordgo.MessageSend) (*discordgo.Message, error) {
+	channelId := notifier.Message.ChannelId
+	channel := &discordgo.Channel{ID: channelId, Type: discordgo.ChannelTypeGuildText}
+	var err error
+	if !notifier.Message.Webhook.IsActive() {
+		if channel, err = m.getChannel(channelId); err != nil {
+			return nil, fmt.Errorf("failed to get channel %s in guild %s: %w", channelId, guildId, err)
+		}
+	}
+
+	thread := domain.DiscordThread{TwitchId: state.TwitchId, ChannelId: channelId, GameName: state.OnlineState.GameName}
+	var newMessage *discordgo.Message
+	if channel.Type == discordgo.ChannelTypeGuildForum {
+		post, err := m.dcInstance.ForumThreadStartComplex(channelId, &discordgo.ThreadStart{
+			Name:                m.getThreadName(notifier.Lang, state),
+			AutoArchiveDuration: domain.ThreadAutoArchiveDuration,
+			AppliedTags:         getForumTags(channel, state.OnlineState.GameName),
+		}, message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start the forum post in channel %s in guild %s: %w", channelId, guildId, err)
+		}
+		newMessage = &discordgo.Message{ID: post.ID, ChannelID: post.ID}
+		thread.Id, thread.Forum = post.ID, true
+	} else {
+		if notifier.Message.Webhook.IsActive() {
+			newMessage, err = m.sendWebhookMessage(notifier, state, message)
+		} else {
+			newMessage, err = m.dcInstance.ChannelMessageSendComplex(channelId, message)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to send discordMessage in channel %s in guild %s: %w", channelId, guildId, err)
+		}
+		if notifier.Message.Crosspost {
+			m.crosspost(guildId, channelId, state, newMessage)
+		}
+		if !notifier.Message.Thread.Active {
+			return newMessage, nil
+		}
+
+		// The announcement is posted, a failed thread is not worth posting it again
+		newThread, err := m.dcInstance.MessageThreadStartComplex(channelId, newMessage.ID, &discordgo.ThreadStart{
+			Name:                m.getThreadName(notifier.Lang, state),
+			AutoArchiveDuration: domain.ThreadAutoArchiveDuration,
+		})
+		if err != nil {
+			internal.DiscordLog.Warn("Failed to start the stream thread", "guildId", guildId, "channelId", channelId, "messageId", newMessage.ID, "error", err)
+			return newMessage, nil
+		}
+		thread.Id = newThread.ID
+	}
+
+	if err = m.database.SetThread(state.TwitchId, channelId, thread); err != nil {
+		internal.DiscordLog.Warn("Failed to save the stream thread", "guildId", guildId, "channelId", channelId, "threadId", thread.Id, "error", err)
+	}
+	return newMessage, nil
+}
+
+// updateThread posts the game changes of the stream in its thread, then the recap once offline and schedules its archiving
+func (m discordMessage) updateThread(notifier domain.DiscordNotifier, state domain.LiveState, thread domain.DiscordThread, at time.Time) error {
+	i18nMessages := m.i18n.GetMessages(notifier.Lang).Discord.Thread
+	streamVariables := state.GetStreamVariables("R")
+	var content string
+	switch {
+	case !state.IsOnline():
+		streamVariables["%duration%"] = formatStreamDuration(at.Sub(state.OnlineState.StartedAt))
+		content = m.i18n.Format(i18nMessages.Recap, streamVariables)
+		thread.ArchiveAt = at.Add(notifier.Message.Thread.GetArchiveAfter())
+	case state.OnlineState.GameName != thread.GameName:
+		content = m.i18n.Format(i18nMessages.GameChanged, streamVariables)
+		thread.GameName = state.OnlineState.GameName
+		if thread.Forum {
+			if err := m.setForumTags(thread); err != nil {
+				internal.DiscordLog.Warn("Failed to tag the forum post", "channelId", thread.ChannelId, "threadId", thread.Id, "error", err)
+			}
+		}
+	default:
+		return nil
+	}
+
+	if content != "" {
+		if posted, err := m.postInThread(thread, content); err != nil || !posted {
+			return err
+		}
+	}
+	return m.database.SetThread(thread.TwitchId, thread.ChannelId, thread)
+}
+
+// HandleRaid posts the raid in the open threads of the streamer concurrently, see DiscordDispatcher
+func (m discordMessage) HandleRaid(raid domain.TwitchRaid) error {
+	var tasks []DiscordTask
+	var errs []error
+	for guildId, notifiers := range m.configStore.Get().Discord.Servers {
+		for _, notifier := range notifiers {
+			if notifier.Message.ChannelId == "" || notifier.TwitchId != raid.FromTwitchId {
+				continue
+			}
+
+			thread, err := m.database.GetThread(raid.FromTwitchId, notifier.Message.ChannelId)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get the thread of channel %s in guild %s: %w", notifier.Message.ChannelId, guildId, err))
+				continue
+			} else if thread.Id == "" || thread.IsEnded() {
+				continue
+			}
+
+			content := m.i18n.Format(m.i18n.GetMessages(notifier.Lang).Discord.Thread.Raid, map[string]string{
+				"%target%":    raid.ToTwitchDisplayName,
+				"%targetUrl%": fmt.Sprintf("https://twitch.tv/%s", url.PathEscape(raid.ToTwitchName)),
+				"%viewers%":   strconv.Itoa(raid.Viewers),
+			})
+			tasks = append(tasks, DiscordTask{
+				Priority: domain.DiscordPriorityUpdate,
+				Bucket:   discordgo.EndpointChannelMessages(thread.Id),
+				Run: func() error {
+					_, err := m.postInThread(thread, content)
+					return err
+				},
+			})
+		}
+	}
+
+	return errors.Join(append(errs, m.dispatcher.Run(tasks))...)
+}
+
+// postInThread posts the content in the thread, posted is false when the thread was deleted by a moderator and is forgotten
+func (m discordMessage) postInThread(thread domain.DiscordThread, content string) (posted bool, err error) {
+	_, err = m.dcInstance.ChannelMessageSendComplex(thread.Id, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if isDiscordNotFound(err) {
+		return false, m.database.SetThread(thread.TwitchId, thread.ChannelId, domain.DiscordThread{})
+	} else if err != nil {
+		return false, fmt.Errorf("failed to post in thread %s of channel %s: %w", thread.Id, thread.ChannelId, err)
+	}
+	return true, nil
+}
+
+// ArchiveThreads archives and locks the threads of the ended streams once their domain.ThreadPolicy delay is over
+func (m discordMessage) ArchiveThreads() error {
+	threads, err := m.database.GetThreads()
+	if err != nil {
+		return err
+	}
+
+	var tasks []DiscordTask
+	now := time.Now()
+	for _, thread := range threads {
+		if !thread.IsEnded() || thread.ArchiveAt.After(now) {
+			continue
+		}
+		tasks = append(tasks, DiscordTask{
+			Priority: domain.DiscordPriorityUpdate,
+			Bucket:   discordgo.EndpointChannel(thread.Id),
+			Run:      func() error { return m.archiveThread(thread) },
+		})
+	}
+	return m.dispatcher.Run(tasks)
+}
+
+// archiveThread archives and locks the thread then forgets it, a thread already deleted on Discord is only forgotten
+func (m discordMessage) archiveThread(thread domain.DiscordThread) error {
+	archived, locked := true, true
+	_, err := m.dcInstance.ChannelEditComplex(thread.Id, &discordgo.ChannelEdit{Archived: &archived, Locked: &locked})
+	if err != nil && !isDiscordNotFound(err) {
+		return fmt.Errorf("failed to archive thread %s of channel %s: %w", thread.Id, thread.ChannelId, err)
+	}
+	return m.database.SetThread(thread.TwitchId, thread.ChannelId, domain.DiscordThread{})
+}
+
+func (m discordMessage) setForumTags(thread domain.DiscordThread) error {
+	forum, err := m.getChannel(thread.ChannelId)
+	if err != nil {
+		return err
+	}
+	tags := getForumTags(forum, thread.GameName)
+	_, err = m.dcInstance.ChannelEditComplex(thread.Id, &discordgo.ChannelEdit{AppliedTags: &tags})
+	return err
+}
+
+// getChannel returns the channel from the gateway cache, or from the API when it is not cached
+func (m discordMessage) getChannel(channelId string) (*discordgo.Channel, error) {
+	if channel, err := m.dcInstance.State.Channel(channelId); err == nil {
+		return channel, nil
+	}
+	return m.dcInstance.Channel(channelId)
+}
+
+// getThreadName returns the thread name of the stream, the streamer name when the lang has none
+func (m discordMessage) getThreadName(lang string, state domain.LiveState) string {
+	name := m.i18n.Format(m.i18n.GetMessages(lang).Discord.Thread.Name, state.GetStreamVariables("R"))
+	if name == "" {
+		name = state.TwitchName
+	}
+	if runes := []rune(name); len(runes) > domain.ThreadNameMaxLength {
+		name = string(runes[:domain.ThreadNameMaxLength])
+	}
+	return name
+}
+
+// getForumTags returns the tag of the forum named like the game, the game is not tagged when the forum has no such tag
+func getForumTags(forum *discordgo.Channel, gameName string) []string {
+	tags := []string{}
+	for _, tag := range forum.AvailableTags {
+		if gameName != "" && strings.EqualFold(tag.Name, gameName) {
+			tags = append(tags, tag.ID)
+		}
+	}
+	return tags
+}
+
+func formatStreamDuration(duration time.Duration) string {
+	return fmt.Sprintf("%dh%02d", int(duration.Hours()), int(duration.Minutes())%60)
+}
@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"slices"
+	"sync"
+)
+
+// webhookCache holds the webhooks created by the bot, channelId as key
+type webhookCache struct {
+	mu       sync.Mutex // Held while a webhook is found or created, a channel gets a single one
+	webhooks map[string]*discordgo.Webhook
+}
+
+func newWebhookCache() *webhookCache {
+	return &webhookCache{webhooks: make(map[string]*discordgo.Webhook)}
+}
+
+// getWebhook returns the webhook posting the messages of the notifier, see domain.WebhookPolicy
+func (m discordMessage) getWebhook(notifier domain.DiscordNotifier) (*discordgo.Webhook, error) {
+	if webhookUrl := notifier.Message.Webhook.Url; webhookUrl != "" {
+		id, token, ok := domain.ParseWebhookUrl(webhookUrl)
+		if !ok {
+			return nil, errors.New("invalid webhook URL")
+		}
+		return &discordgo.Webhook{ID: id, Token: token}, nil
+	}
+
+	channelId := notifier.Message.ChannelId
+	m.webhooks.mu.Lock()
+	defer m.webhooks.mu.Unlock()
+	if webhook, ok := m.webhooks.webhooks[channelId]; ok {
+		return webhook, nil
+	}
+
+	webhooks, err := m.dcInstance.ChannelWebhooks(channelId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the webhooks of channel %s: %w", channelId, err)
+	}
+	// Matched by application, the name is not enough: the incoming webhooks of the members also come with their token.
+	// The application id of a bot is its user id
+	botId := m.dcInstance.State.User.ID
+	index := slices.IndexFunc(webhooks, func(webhook *discordgo.Webhook) bool {
+		return webhook.ApplicationID == botId && webhook.Token != ""
+	})
+	var webhook *discordgo.Webhook
+	if index >= 0 {
+		webhook = webhooks[index]
+	} else if webhook, err = m.dcInstance.WebhookCreate(channelId, domain.WebhookName, ""); err != nil {
+		return nil, fmt.Errorf("failed to create the webhook of channel %s: %w", channelId, err)
+	}
+	m.webhooks.webhooks[channelId] = webhook
+	return webhook, nil
+}
+
+// forgetWebhook drops a webhook deleted on Discord, the next message creates a new one
+func (m discordMessage) forgetWebhook(channelId string) {
+	m.webhooks.mu.Lock()
+	defer m.webhooks.mu.Unlock()
+	delete(m.webhooks.webhooks, channelId)
+}
+
+// sendWebhookMessage posts the message with the name and avatar of the streamer, a webhook of the bot deleted on Discord is created again
+func (m discordMessage) sendWebhookMessage(notifier domain.DiscordNotifier, state domain.LiveState, message *discordgo.MessageSend) (*discordgo.Message, error) {
+	user := m.configStore.Get().Twitch.UserResolver[state.TwitchId]
+	send := func() (*discordgo.Message, error) {
+		webhook, err := m.getWebhook(notifier)
+		if err != nil {
+			return nil, err
+		}
+		return m.dcInstance.WebhookExecute(webhook.ID, webhook.Token, true, &discordgo.WebhookParams{
+			Content:         message.Content,
+			Username:        user.TwitchDisplayName,
+			AvatarURL:       user.TwitchProfileImageUrl,
+			Components:      getWebhookComponents(webhook, message.Components),
+			Embeds:          []*discordgo.MessageEmbed{message.Embed},
+			AllowedMentions: message.AllowedMentions,
+		})
+	}
+
+	newMessage, err := send()
+	if isDiscordUnknownWebhook(err) && notifier.Message.Webhook.Url == "" {
+		m.forgetWebhook(notifier.Message.ChannelId)
+		newMessage, err = send()
+	}
+	return newMessage, err
+}
+
+// editWebhookMessage edits a message posted by the webhook, a webhook of the bot deleted on Discord is reported like a deleted message
+func (m discordMessage) editWebhookMessage(notifier domain.DiscordNotifier, edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+	webhook, err := m.getWebhook(notifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var components *[]discordgo.MessageComponent
+	if edit.Components != nil {
+		webhookComponents := getWebhookComponents(webhook, *edit.Components)
+		components = &webhookComponents
+	}
+	newMessage, err := m.dcInstance.WebhookMessageEdit(webhook.ID, webhook.Token, edit.ID, &discordgo.WebhookEdit{
+		Content:         edit.Content,
+		Components:      components,
+		Embeds:          &[]*discordgo.MessageEmbed{edit.Embed},
+		AllowedMentions: edit.AllowedMentions,
+	})
+	if isDiscordUnknownWebhook(err) && notifier.Message.Webhook.Url == "" {
+		m.forgetWebhook(notifier.Message.ChannelId)
+	}
+	return newMessage, err
+}
+
+func (m discordMessage) deleteWebhookMessage(notifier domain.DiscordNotifier, messageId string) error {
+	webhook, err := m.getWebhook(notifier)
+	if err != nil {
+		return err
+	}
+	return m.dcInstance.WebhookMessageDelete(webhook.ID, webhook.Token, messageId)
+}
+
+// getWebhookComponents drops the buttons of a webhook given by URL, only the webhooks of an application can post them
+func getWebhookComponents(webhook *discordgo.Webhook, components []discordgo.MessageComponent) []discordgo.MessageComponent {
+	if webhook.ApplicationID == "" {
+		return []discordgo.MessageComponent{}
+	}
+	return components
+}
+
+// isDiscordUnknownWebhook reports whether the webhook was deleted on Discord
+func isDiscordUnknownWebhook(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeUnknownWebhook
+}
@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health tracks the state of the dependencies for the readiness endpoint
+type Health interface {
+	WatchCron(job string, interval time.Duration)
+	CronSucceeded(job string)
+	CheckReadiness() domain.ReadinessReport
+}
+
+func NewHealth(configStore internal.ConfigStore, session *discordgo.Session, twClient internal.TwitchClient, database internal.Database) Health {
+	return &health{
+		configStore: configStore,
+		session:     session,
+		twClient:    twClient,
+		database:    database,
+		cronJobs:    make(map[string]*cronJobHealth),
+	}
+}
+
+type health struct {
+	configStore internal.ConfigStore
+	session     *discordgo.Session
+	twClient    internal.TwitchClient
+	database    internal.Database
+
+	mu       sync.Mutex
+	cronJobs map[string]*cronJobHealth // Key is the job name
+
+	subscriptionsMu        sync.Mutex
+	subscriptionsCheckedAt time.Time
+	subscriptionsErr       error // Cached for domain.HealthSubscriptionsCacheTtl
+}
+
+type cronJobHealth struct {
+	interval    time.Duration
+	lastSuccess time.Time // Start of the watch until the first success
+}
+
+// WatchCron makes the readiness fail when the job didn't succeed within its interval
+func (h *health) WatchCron(job string, interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cronJobs[job] = &cronJobHealth{interval: interval, lastSuccess: time.Now()}
+}
+
+func (h *health) CronSucceeded(job string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cronJob, ok := h.cronJobs[job]; ok {
+		cronJob.lastSuccess = time.Now()
+	}
+}
+
+// CheckReadiness checks the Discord gateway, the Twitch app token, the EventSub subscriptions, the database and the cron jobs
+func (h *health) CheckReadiness() domain.ReadinessReport {
+	checks := map[string]error{
+		domain.ReadinessDiscord:       h.checkDiscord(),
+		domain.ReadinessTwitchToken:   h.checkTwitchToken(),
+		domain.ReadinessSubscriptions: h.checkSubscriptions(),
+		domain.ReadinessDatabase:      h.database.Ping(),
+	}
+	h.mu.Lock()
+	for job, cronJob := range h.cronJobs {
+		checks[domain.ReadinessCronPrefix+job] = checkCronJob(cronJob)
+	}
+	h.mu.Unlock()
+
+	report := domain.ReadinessReport{Ready: true, Checks: make(map[string]string, len(checks))}
+	for name, err := range checks {
+		if err != nil {
+			report.Ready = false
+			report.Checks[name] = err.Error()
+		} else {
+			report.Checks[name] = domain.ReadinessOk
+		}
+	}
+	return report
+}
+
+func (h *health) checkDiscord() error {
+	h.session.RLock()
+	defer h.session.RUnlock()
+	if !h.session.DataReady {
+		return fmt.Errorf("gateway not connected")
+	}
+	return nil
+}
+
+func (h *health) checkTwitchToken() error {
+	if !h.twClient.HasValidToken() {
+		return fmt.Errorf("app token missing or expired")
+	}
+	return nil
+}
+
+// checkSubscriptions expects an enabled or pending subscription of every type for every streamer
+func (h *health) checkSubscriptions() error {
+	h.subscriptionsMu.Lock()
+	defer h.subscriptionsMu.Unlock()
+	if time.Since(h.subscriptionsCheckedAt) < domain.HealthSubscriptionsCacheTtl {
+		return h.subscriptionsErr
+	}
+
+	h.subscriptionsErr = h.getSubscriptionsProblem()
+	h.subscriptionsCheckedAt = time.Now()
+	return h.subscriptionsErr
+}
+
+func (h *health) getSubscriptionsProblem() error {
+	statuses, err := h.twClient.GetSubscriber().GetSubscriptionStatuses()
+	if err != nil {
+		return err
+	}
+
+	healthy := make(map[string]bool) // Key is broadcasterId/type
+	for _, status := range statuses {
+		if status.Status == string(esf.StatusEnabled) || status.Status == string(esf.StatusVerificationPending) {
+			healthy[status.BroadcasterId+"/"+status.Type] = true
+		}
+	}
+
+	var missing []string
+	for _, twitchId := range h.configStore.Get().Discord.GetAllTwitchIds() {
+		for _, subType := range domain.SubscriptionList {
+			if !healthy[twitchId+"/"+subType] {
+				missing = append(missing, twitchId+"/"+subType)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return fmt.Errorf("not enabled: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkCronJob(cronJob *cronJobHealth) error {
+	if elapsed := time.Since(cronJob.lastSuccess); elapsed > cronJob.interval+domain.HealthCronGracePeriod {
+		return fmt.Errorf("no success for %s", elapsed.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NotificationOutbox stores the Discord announcement jobs in the database and delivers them with a worker pool,
+// a failed job is retried on its own with an exponential backoff, including after a restart
+type NotificationOutbox interface {
+	Enqueue(jobs []domain.OutboxJob) error
+	HasPendingJob(twitchId string, channelId string) (bool, error)
+	Start(deliverer OutboxDeliverer)
+	Shutdown(ctx context.Context) error
+	GetJobs() ([]domain.OutboxJob, error)
+	GetDeadJobs() ([]domain.OutboxJob, error)
+	RetryDeadJob(id uint64) error
+	DeleteDeadJob(id uint64) error
+}
+
+// OutboxDeliverer delivers the outbox jobs, implemented by DiscordMessage
+type OutboxDeliverer interface {
+	Deliver(job domain.OutboxJob) error
+	GetDeliveryWait(job domain.OutboxJob) time.Duration // Rate limit wait of the job route, the other jobs are delivered meanwhile
+}
+
+func NewNotificationOutbox(database internal.Database, metrics *internal.Metrics) NotificationOutbox {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &notificationOutbox{
+		database: database,
+		metrics:  metrics,
+		inFlight: make(map[string]bool),
+		wake:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+type notificationOutbox struct {
+	database  internal.Database
+	metrics   *internal.Metrics
+	deliverer OutboxDeliverer
+
+	mu       sync.Mutex
+	inFlight map[string]bool // Notifier keys of the jobs being delivered
+	wake     chan struct{}   // Closed to wake up the idle workers
+
+	workers sync.WaitGroup
+	ctx     context.Context // Cancelled on shutdown, the pending jobs stay in the database
+	cancel  context.CancelFunc
+}
+
+// Enqueue stores the jobs, they are delivered once Start is called
+func (o *notificationOutbox) Enqueue(jobs []domain.OutboxJob) error {
+	if err := o.database.AddOutboxJobs(jobs); err != nil {
+		return fmt.Errorf("failed to queue %d outbox jobs: %w", len(jobs), err)
+	}
+	o.notify()
+	return nil
+}
+
+// HasPendingJob reports whether an announcement update is still queued for the notifier channel
+func (o *notificationOutbox) HasPendingJob(twitchId string, channelId string) (bool, error) {
+	jobs, err := o.database.GetOutboxJobs()
+	if err != nil {
+		return false, err
+	}
+	for _, job := range jobs {
+		if job.Notifier.TwitchId == twitchId && job.Notifier.Message.ChannelId == channelId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (o *notificationOutbox) Start(deliverer OutboxDeliverer) {
+	o.deliverer = deliverer
+	for range domain.DiscordDispatchConcurrency {
+		o.workers.Add(1)
+		go o.work()
+	}
+}
+
+// Shutdown stops the workers and waits for the jobs being delivered, the others are delivered after the restart
+func (o *notificationOutbox) Shutdown(ctx context.Context) error {
+	o.cancel()
+	stopped := make(chan struct{})
+	go func() {
+		o.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("outbox workers not stopped: %w", ctx.Err())
+	}
+}
+
+func (o *notificationOutbox) GetJobs() ([]domain.OutboxJob, error) {
+	return o.database.GetOutboxJobs()
+}
+
+func (o *notificationOutbox) GetDeadJobs() ([]domain.OutboxJob, error) {
+	return o.database.GetDeadOutboxJobs()
+}
+
+// RetryDeadJob queues a dead letter again with its attempts reset
+func (o *notificationOutbox) RetryDeadJob(id uint64) error {
+	if err := o.database.RequeueDeadOutboxJob(id); err != nil {
+		return err
+	}
+	o.notify()
+	return nil
+}
+
+func (o *notificationOutbox) DeleteDeadJob(id uint64) error {
+	return o.database.DeleteDeadOutboxJob(id)
+}
+
+func (o *notificationOutbox) work() {
+	defer o.workers.Done()
+	for o.ctx.Err() == nil {
+		o.mu.Lock()
+		wake := o.wake
+		o.mu.Unlock()
+
+		job, nextAttemptAt, err := o.claim()
+		if err != nil {
+			internal.DiscordLog.Error("Outbox failed to read the jobs", "error", err)
+		} else if job != nil {
+			o.process(*job)
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(nextAttemptAt))
+		select {
+		case <-o.ctx.Done():
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// claim returns the job to deliver, or when the next one is due. A notifier has one job delivered at a time and
+// in order, so a failing guild only delays its own announcements. The first announcements go before the edits,
+// then the oldest job whose route is not rate limited
+func (o *notificationOutbox) claim() (*domain.OutboxJob, time.Time, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	nextAttemptAt := now.Add(domain.OutboxPollInterval)
+	jobs, err := o.database.GetOutboxJobs()
+	if err != nil {
+		return nil, nextAttemptAt, err
+	}
+
+	var claimed *domain.OutboxJob
+	waiting := make(map[string]bool) // Notifiers with an older job in flight or waiting for its backoff
+	for _, job := range jobs {
+		notifierKey := job.NotifierKey()
+		if waiting[notifierKey] || o.inFlight[notifierKey] {
+			waiting[notifierKey] = true
+			continue
+		}
+		waiting[notifierKey] = true
+
+		if job.NextAttemptAt.After(now) {
+			if job.NextAttemptAt.Before(nextAttemptAt) {
+				nextAttemptAt = job.NextAttemptAt
+			}
+			continue
+		}
+		if claimed != nil && claimed.GetPriority() <= job.GetPriority() {
+			continue
+		}
+		if wait := o.deliverer.GetDeliveryWait(job); wait > 0 {
+			if now.Add(wait).Before(nextAttemptAt) {
+				nextAttemptAt = now.Add(wait)
+			}
+			continue
+		}
+		claimed = &job
+	}
+
+	if claimed != nil {
+		o.inFlight[claimed.NotifierKey()] = true
+	}
+	return claimed, nextAttemptAt, nil
+}
+
+// process delivers the job then removes it, schedules its next attempt or moves it to the dead letters
+func (o *notificationOutbox) process(job domain.OutboxJob) {
+	logger := internal.DiscordLog.With("jobId", job.Id, "intent", job.Intent, "guildId", job.GuildId,
+		"twitchId", job.Notifier.TwitchId, "channelId", job.Notifier.Message.ChannelId)
+	deliverErr := o.deliverer.Deliver(job)
+
+	var err error
+	switch {
+	case deliverErr == nil:
+		o.metrics.OutboxJobs.Inc(internal.MetricsOutboxDelivered)
+		err = o.database.DeleteOutboxJob(job.Id)
+	case job.Attempts+1 >= domain.OutboxMaxAttempts || isDiscordClientError(deliverErr):
+		job.Attempts++
+		job.LastError = deliverErr.Error()
+		o.metrics.OutboxJobs.Inc(internal.MetricsOutboxDead)
+		logger.Error("Outbox job given up", "attempts", job.Attempts, "error", deliverErr)
+		err = o.database.MoveOutboxJobToDead(job)
+	default:
+		job.Attempts++
+		job.LastError = deliverErr.Error()
+		job.NextAttemptAt = time.Now().Add(job.GetBackoff())
+		o.metrics.OutboxJobs.Inc(internal.MetricsOutboxRetried)
+		logger.Warn("Outbox job failed, retrying", "attempts", job.Attempts, "nextAttemptAt", job.NextAttemptAt, "error", deliverErr)
+		err = o.database.SetOutboxJob(job)
+	}
+	if err != nil {
+		logger.Error("Outbox failed to update the job", "error", err) // Delivered again, the intent is checked against the stored message
+	}
+
+	// Released after the update, another worker would deliver the stored job again
+	o.mu.Lock()
+	delete(o.inFlight, job.NotifierKey())
+	o.mu.Unlock()
+	o.notify() // The next job of the notifier is ready
+}
+
+// notify wakes up the idle workers
+func (o *notificationOutbox) notify() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	close(o.wake)
+	o.wake = make(chan struct{})
+}
+
+// isDiscordClientError reports whether Discord rejected the request (missing access, unknown channel...), retrying would fail the same way
+func isDiscordClientError(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil &&
+		restErr.Response.StatusCode >= http.StatusBadRequest && restErr.Response.StatusCode < http.StatusInternalServerError &&
+		restErr.Response.StatusCode != http.StatusTooManyRequests
+}
@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"LiveStatus/src/domain"
+	"LiveStatus/src/internal"
+	"time"
+)
+
+// StreamHistory records the stream sessions of every streamer, shown in the dashboard
+type StreamHistory interface {
+	HandleLiveState(state domain.LiveState) error
+}
+
+func NewStreamHistory(database internal.Database) StreamHistory {
+	return &streamHistory{
+		database: database,
+	}
+}
+
+type streamHistory struct {
+	database internal.Database
+}
+
+// HandleLiveState opens a session when the streamer goes online and closes it when it goes offline,
+// only the domain.HistoryMaxSessions most recent sessions are kept
+func (h *streamHistory) HandleLiveState(state domain.LiveState) error {
+	sessions, err := h.database.GetStreamSessions(state.TwitchId)
+	if err != nil {
+		return err
+	}
+
+	var last *domain.StreamSession
+	if len(sessions) > 0 && sessions[len(sessions)-1].EndedAt == nil {
+		last = &sessions[len(sessions)-1]
+	}
+
+	now := time.Now()
+	if state.IsOnline() {
+		online := state.OnlineState
+		if last != nil && last.StartedAt.Equal(online.StartedAt) {
+			if last.Title == online.Title && last.GameName == online.GameName && last.StreamType == online.Type {
+				return nil
+			}
+		} else {
+			if last != nil {
+				last.EndedAt = &now // Missed offline notification
+			}
+			sessions = append(sessions, domain.StreamSession{StartedAt: online.StartedAt})
+			last = &sessions[len(sessions)-1]
+		}
+		last.StreamType = online.Type
+		last.Title = online.Title
+		last.GameName = online.GameName
+	} else if last != nil {
+		last.EndedAt = &now
+	} else {
+		return nil
+	}
+
+	if len(sessions) > domain.HistoryMaxSessions {
+		sessions = sessions[len(sessions)-domain.HistoryMaxSessions:]
+	}
+	return h.database.SetStreamSessions(state.TwitchId, sessions)
+}
@@ -3,36 +3,58 @@ package usecase
 import (
 	"LiveStatus/src/domain"
 	"LiveStatus/src/internal"
+	"context"
 	"fmt"
 	"github.com/avast/retry-go/v4"
 	esb "github.com/dnsge/twitch-eventsub-bindings"
 	esf "github.com/dnsge/twitch-eventsub-framework"
-	"log"
+	"sync"
 )
 
 type TwitchHandler interface {
 	GetHandler() *esf.SubHandler
+	Shutdown(ctx context.Context) error
 }
 
-func NewTwitchHandler(mapTwitchIdsToState map[string]*domain.LiveState, twClient internal.TwitchClient, webhookSecret string) TwitchHandler {
+// NewTwitchHandler handles the EventSub notifications, the live states are refreshed from Helix and the raids are
+// passed to raidFunction
+func NewTwitchHandler(mapTwitchIdsToState *domain.LiveStates, twClient internal.TwitchClient, webhookSecret string, raidFunction func(raid domain.TwitchRaid) error, metrics *internal.Metrics) TwitchHandler {
 	subHandler := esf.NewSubHandler(true, []byte(webhookSecret))
+	ctx, cancel := context.WithCancel(context.Background())
 	h := &twitchHandler{
 		handler:             subHandler,
 		mapTwitchIdsToState: mapTwitchIdsToState,
 		twClient:            twClient,
+		raidFunction:        raidFunction,
+		metrics:             metrics,
+		ctx:                 ctx,
+		cancel:              cancel,
 	}
 
 	subHandler.HandleChannelUpdate = func(headers *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
-		log.Printf("HandleChannelUpdate (twitchId=%s)\n", event.BroadcasterUserID)
-		h.updateLiveState(event.BroadcasterUserID, headers.SubscriptionType)
+		internal.TwitchLog.Info("HandleChannelUpdate", "twitchId", event.BroadcasterUserID, "messageId", headers.MessageID)
+		metrics.EventSubNotifications.Inc(headers.SubscriptionType)
+		h.updateLiveState(event.BroadcasterUserID, headers.SubscriptionType, "", event)
 	}
 	subHandler.HandleStreamOnline = func(headers *esb.ResponseHeaders, event *esb.EventStreamOnline) {
-		log.Printf("HandleStreamOnline (twitchId=%s)\n", event.BroadcasterUserID)
-		h.updateLiveState(event.BroadcasterUserID, headers.SubscriptionType)
+		internal.TwitchLog.Info("HandleStreamOnline", "twitchId", event.BroadcasterUserID, "messageId", headers.MessageID, "streamType", event.Type)
+		metrics.EventSubNotifications.Inc(headers.SubscriptionType)
+		h.updateLiveState(event.BroadcasterUserID, headers.SubscriptionType, event.Type, nil)
 	}
 	subHandler.HandleStreamOffline = func(headers *esb.ResponseHeaders, event *esb.EventStreamOffline) {
-		log.Printf("HandleStreamOffline (twitchId=%s)\n", event.BroadcasterUserID)
-		h.updateLiveState(event.BroadcasterUserID, headers.SubscriptionType)
+		internal.TwitchLog.Info("HandleStreamOffline", "twitchId", event.BroadcasterUserID, "messageId", headers.MessageID)
+		metrics.EventSubNotifications.Inc(headers.SubscriptionType)
+		h.updateLiveState(event.BroadcasterUserID, headers.SubscriptionType, "", nil)
+	}
+	subHandler.HandleChannelRaid = func(headers *esb.ResponseHeaders, event *esb.EventChannelRaid) {
+		internal.TwitchLog.Info("HandleChannelRaid", "twitchId", event.FromBroadcasterUserID, "messageId", headers.MessageID, "toTwitchId", event.ToBroadcasterUserID)
+		metrics.EventSubNotifications.Inc(headers.SubscriptionType)
+		h.handleRaid(domain.TwitchRaid{
+			FromTwitchId:        event.FromBroadcasterUserID,
+			ToTwitchName:        event.ToBroadcasterUserLogin,
+			ToTwitchDisplayName: event.ToBroadcasterUserName,
+			Viewers:             event.Viewers,
+		})
 	}
 
 	return h
@@ -40,59 +62,118 @@ func NewTwitchHandler(mapTwitchIdsToState map[string]*domain.LiveState, twClient
 
 type twitchHandler struct {
 	handler             *esf.SubHandler
-	mapTwitchIdsToState map[string]*domain.LiveState
+	mapTwitchIdsToState *domain.LiveStates
 	twClient            internal.TwitchClient
+	raidFunction        func(raid domain.TwitchRaid) error
+	metrics             *internal.Metrics
+
+	updates sync.WaitGroup  // In-flight updateLiveState and handleRaid
+	ctx     context.Context // Cancelled when the updates are not drained in time
+	cancel  context.CancelFunc
 }
 
 func (h *twitchHandler) GetHandler() *esf.SubHandler {
 	return h.handler
 }
 
-func (h *twitchHandler) updateLiveState(twitchId string, twitchSubscriptionType string) {
+// Shutdown waits for the in-flight live state updates, the webhook server must be shut down first.
+// When ctx expires, the pending retries are aborted: the states are fetched again from Helix on startup
+func (h *twitchHandler) Shutdown(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		h.updates.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		h.cancel()
+		return fmt.Errorf("live state updates not drained: %w", ctx.Err())
+	}
+}
+
+// handleRaid posts the raid without retrying it, the threads where it was posted would get it twice
+func (h *twitchHandler) handleRaid(raid domain.TwitchRaid) {
+	h.updates.Add(1)
+	go func() {
+		defer h.updates.Done()
+		if err := h.raidFunction(raid); err != nil {
+			internal.TwitchLog.Error("Failed to post the raid", "twitchId", raid.FromTwitchId, "toTwitchName", raid.ToTwitchName, "error", err)
+		}
+	}()
+}
+
+// updateLiveState refreshes the state from Helix, streamType is only set for StreamOnline notifications
+// and channelUpdate for ChannelUpdate ones (Helix can lag behind the notification)
+func (h *twitchHandler) updateLiveState(twitchId string, twitchSubscriptionType string, streamType string, channelUpdate *esb.EventChannelUpdate) {
+	logger := internal.TwitchLog.With("twitchId", twitchId, "subscriptionType", twitchSubscriptionType)
 	errorAndLog := func(format string, args ...any) error {
 		err := fmt.Errorf(format, args...)
-		log.Printf("%v\n", err)
+		logger.Error("updateLiveState attempt failed", "error", err)
 		return err
 	}
 
+	h.updates.Add(1)
 	go func() {
+		defer h.updates.Done()
 		err := retry.Do(func() error {
-			if liveState, stateOk := h.mapTwitchIdsToState[twitchId]; stateOk {
+			if liveState, stateOk := h.mapTwitchIdsToState.Get(twitchId); stateOk {
+				switch twitchSubscriptionType {
+				case domain.StreamOnline:
+					liveState.EventStreamType = streamType
+				case domain.StreamOffline:
+					liveState.EventStreamType = ""
+				}
+
 				streams, err := h.twClient.GetStreams([]string{twitchId})
 				if err != nil {
-					return errorAndLog("ERROR updateLiveState GetStreams (twitchId=%s): %v", twitchId, err)
+					return errorAndLog("GetStreams: %w", err)
 				}
 
 				var setLiveStateErr error
 				if stream, streamOk := streams[twitchId]; streamOk {
 					if twitchSubscriptionType == domain.StreamOffline {
-						return errorAndLog("  ERROR updateLiveState prevent SetLiveState online (twitchId=%s), received StreamOffline, streams: %+v", twitchId, streams)
+						return errorAndLog("prevent SetLiveState online, received StreamOffline, streams: %+v", streams)
+					}
+
+					if channelUpdate != nil {
+						stream.Title = channelUpdate.Title
+						stream.GameId = channelUpdate.CategoryID
+						stream.GameName = channelUpdate.CategoryName
+						stream.Language = channelUpdate.Language
 					}
 
 					setLiveStateErr = liveState.SetLiveState(&stream)
-					log.Printf("  updateLiveState SetLiveState online (twitchId=%s)\n", twitchId)
+					logger.Info("updateLiveState SetLiveState online", "streamType", liveState.OnlineState.Type)
 				} else {
 					if twitchSubscriptionType == domain.StreamOnline {
-						return errorAndLog("  ERROR updateLiveState prevent SetLiveState offline (twitchId=%s), received StreamOnline, streams: %+v", twitchId, streams)
+						return errorAndLog("prevent SetLiveState offline, received StreamOnline, streams: %+v", streams)
 					}
 
 					setLiveStateErr = liveState.SetLiveState(nil)
-					log.Printf("  updateLiveState SetLiveState offline (twitchId=%s)\n", twitchId)
+					logger.Info("updateLiveState SetLiveState offline")
 				}
 
 				if setLiveStateErr != nil {
-					return errorAndLog("ERROR updateLiveState SetLiveState (twitchId=%s): %v", twitchId, setLiveStateErr)
+					return errorAndLog("SetLiveState: %w", setLiveStateErr)
 				}
 
-				log.Printf("  updateLiveState succeed (twitchId=%s)\n", twitchId)
+				logger.Debug("updateLiveState succeed")
 				return nil
 			}
 
-			return errorAndLog("ERROR updateLiveState liveState not found (twitchId=%s)", twitchId)
-		}, retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay))
+			return errorAndLog("liveState not found")
+		}, retry.Context(h.ctx), retry.Attempts(domain.RetryMaxAttempts), retry.Delay(domain.RetryDelay), retry.OnRetry(func(n uint, err error) {
+			if n < domain.RetryMaxAttempts-1 { // Also called after the last attempt
+				h.metrics.LiveStateUpdateRetries.Inc(twitchSubscriptionType)
+			}
+		}))
 
 		if err != nil {
-			log.Printf("ERROR updateLiveState retry failed (twitchId=%s)\n", twitchId)
+			h.metrics.LiveStateUpdateFailures.Inc(twitchSubscriptionType)
+			logger.Error("updateLiveState retry failed", "error", err)
 		}
 	}()
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	esb "github.com/dnsge/twitch-eventsub-bindings"
 	esf "github.com/dnsge/twitch-eventsub-framework"
+	"slices"
 )
 
 func NewTwitchSubscriber(clientId string, appToken string, webhookUrl string, webhookSecret string) domain.TwitchSubscriber {
@@ -41,7 +42,53 @@ func (s *twitchSubscriber) UnsubscribeAll() error {
 	return nil
 }
 
-// SubscribeAll subscribes to the "stream.online" and "stream.offline" event types for the provided broadcasterUserIds.
+// Unsubscribe removes every subscription of the provided broadcasterUserIds
+func (s *twitchSubscriber) Unsubscribe(broadcasterUserIds []string) error {
+	if len(broadcasterUserIds) == 0 {
+		return nil
+	}
+
+	subscriptions, err := s.getSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subscriptions.Data {
+		broadcasterUserId, err := getSubscriptionBroadcasterId(sub)
+		if err != nil || !slices.Contains(broadcasterUserIds, broadcasterUserId) {
+			continue
+		}
+		if err = s.client.Unsubscribe(context.Background(), sub.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSubscriptionStatuses returns the status of every subscription of the app
+func (s *twitchSubscriber) GetSubscriptionStatuses() ([]domain.TwitchSubscriptionStatus, error) {
+	subscriptions, err := s.getSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]domain.TwitchSubscriptionStatus, 0, len(subscriptions.Data))
+	for _, sub := range subscriptions.Data {
+		broadcasterUserId, err := getSubscriptionBroadcasterId(sub)
+		if err != nil {
+			continue
+		}
+		statuses = append(statuses, domain.TwitchSubscriptionStatus{
+			BroadcasterId: broadcasterUserId,
+			Type:          sub.Type,
+			Status:        sub.Status,
+		})
+	}
+	return statuses, nil
+}
+
+// SubscribeAll subscribes to the domain.SubscriptionList event types for the provided broadcasterUserIds.
 // Returns:
 //   - int: the total cost used
 //   - int: the maximum total cost allowed
@@ -56,12 +103,10 @@ func (s *twitchSubscriber) SubscribeAll(broadcasterUserIds []string) (int, int,
 	for _, broadcasterUserId := range broadcasterUserIds {
 		for _, subType := range domain.SubscriptionList {
 			resp, err := s.client.Subscribe(context.Background(), &esf.SubRequest{
-				Type: subType,
-				Condition: esb.ConditionChannelUpdate{
-					BroadcasterUserID: broadcasterUserId,
-				},
-				Callback: s.webhookUrl,
-				Secret:   s.webhookSecret,
+				Type:      subType,
+				Condition: getSubscriptionCondition(subType, broadcasterUserId),
+				Callback:  s.webhookUrl,
+				Secret:    s.webhookSecret,
 			})
 			if err != nil {
 				return 0, 0, fmt.Errorf("error subscribing to %s/%s: %w", broadcasterUserId, subType, err)
@@ -72,3 +117,27 @@ func (s *twitchSubscriber) SubscribeAll(broadcasterUserIds []string) (int, int,
 
 	return latestResponse.TotalCost, latestResponse.MaxTotalCost, nil
 }
+
+// getSubscriptionCondition returns the condition of the subscription type for the broadcaster
+func getSubscriptionCondition(subType string, broadcasterUserId string) any {
+	if subType == domain.ChannelRaid {
+		return esb.ConditionChannelRaid{FromBroadcasterUserID: broadcasterUserId}
+	}
+	return esb.ConditionChannelUpdate{BroadcasterUserID: broadcasterUserId}
+}
+
+// getSubscriptionBroadcasterId returns the broadcaster of the subscription condition, see getSubscriptionCondition
+func getSubscriptionBroadcasterId(sub esb.Subscription) (string, error) {
+	if sub.Type == domain.ChannelRaid {
+		condition, err := sub.ConditionChannelRaid()
+		if err != nil {
+			return "", err
+		}
+		return condition.FromBroadcasterUserID, nil
+	}
+	condition, err := sub.ConditionChannelUpdate()
+	if err != nil {
+		return "", err
+	}
+	return condition.BroadcasterUserID, nil
+}